@@ -0,0 +1,102 @@
+package macross
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by the socket activation protocol.
+	listenFdsStart = 3
+
+	// restartFdsEnv holds the number of listeners passed to a process started by Restart.
+	restartFdsEnv = "MACROSS_RESTART_FDS"
+
+	// restartReadyEnv holds the file descriptor a process started by Restart writes to once it serves.
+	restartReadyEnv = "MACROSS_RESTART_READY"
+)
+
+// restartReady is the pipe telling the parent that started the process with Restart
+// that it serves its listeners, nil once it has been told.
+var restartReady struct {
+	sync.Mutex
+	file *os.File
+}
+
+// ActivationListeners returns the listeners passed to the process through
+// systemd-style socket activation, i.e. the LISTEN_PID and LISTEN_FDS environment variables.
+// It returns no listener if the process was not socket activated.
+// The environment variables are unset so that child processes do not inherit them.
+func ActivationListeners() ([]net.Listener, error) {
+	return activationListeners(listenFdsStart)
+}
+
+// activationListeners creates the activation listeners from the file descriptors starting at start.
+func activationListeners(start int) ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return filesListeners(start, n)
+}
+
+// InheritedListeners returns the listeners passed to the process by a parent calling Restart,
+// in the order the parent opened them. If there is none, it falls back to ActivationListeners.
+// The parent is told that the process is ready, and shuts down, once it serves one of them.
+func InheritedListeners() ([]net.Listener, error) {
+	return inheritedListeners(listenFdsStart)
+}
+
+func inheritedListeners(start int) ([]net.Listener, error) {
+	n, err := strconv.Atoi(os.Getenv(restartFdsEnv))
+	if err != nil || n <= 0 {
+		return activationListeners(start)
+	}
+	os.Unsetenv(restartFdsEnv)
+	if fd, err := strconv.Atoi(os.Getenv(restartReadyEnv)); err == nil {
+		os.Unsetenv(restartReadyEnv)
+		restartReady.Lock()
+		restartReady.file = os.NewFile(uintptr(fd), "MACROSS_RESTART_READY")
+		restartReady.Unlock()
+	}
+	return filesListeners(start, n)
+}
+
+// notifyRestarted tells the parent that started the process with Restart that it serves its listeners.
+func notifyRestarted() {
+	restartReady.Lock()
+	f := restartReady.file
+	restartReady.file = nil
+	restartReady.Unlock()
+	if f != nil {
+		f.Write([]byte{1})
+		f.Close()
+	}
+}
+
+// filesListeners creates listeners from the n file descriptors starting at start.
+func filesListeners(start, n int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, n)
+	for fd := start; fd < start+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
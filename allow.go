@@ -0,0 +1,260 @@
+package macross
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// getMethod is the method of the routes serving the HEAD requests without HEAD route.
+var getMethod = []byte(GET)
+
+// allowHeader is the Allow header of a path pattern. It is not exact if a method has routes
+// matching some of the requests of the pattern only, in which case it is found for each request.
+type allowHeader struct {
+	value string
+	exact bool
+}
+
+// compileAllow builds the Allow headers of the route paths of the macross and of its hosts.
+// The Allow header of a path lists the methods of the routes matching all its requests,
+// plus HEAD if GET is allowed, and OPTIONS. A method whose routes only match some of the requests
+// of a path pattern, such as POST "/users/new" for GET "/users/<id>", is only listed for the more
+// specific pattern. If no pattern is more specific, such as POST "/users/<id>" for
+// GET "/users/<id:\d+>", the Allow header of the requests of the pattern is found for each request.
+func (m *Macross) compileAllow() {
+	m.allow = compileAllow(m.table, nil, m.stores)
+	for _, host := range m.hosts {
+		host.allow = compileAllow(m.table, host, host.stores)
+	}
+}
+
+// compileAllow returns a route store matching the paths of the routes registered for the host,
+// whose data is the Allow header of each path.
+func compileAllow(table []routeEntry, host *hostRoutes, stores map[string]routeStore) routeStore {
+	// the prefixes of the wildcard routes by method, which match all the paths starting with them
+	wildcards := make(map[string][]string)
+	for _, entry := range table {
+		if entry.route.group.host == host && strings.HasSuffix(entry.path, "<:.*>") {
+			if p := strings.TrimSuffix(entry.path, "<:.*>"); !strings.Contains(p, "<") {
+				wildcards[entry.method] = append(wildcards[entry.method], p)
+			}
+		}
+	}
+
+	methods := make(map[string][]string) // the methods by path pattern, in the order the patterns are registered
+	var paths, keys []string
+	for _, entry := range table {
+		if entry.route.group.host != host {
+			continue
+		}
+		key := routeKey(nil, "", entry.path)
+		if _, exists := methods[key]; !exists {
+			paths, keys = append(paths, entry.path), append(keys, key)
+		}
+		methods[key] = append(methods[key], entry.method)
+	}
+
+	// the store serves the first pattern added among those matching a path: add the more specific ones first
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return specificity(paths[order[i]]) < specificity(paths[order[j]])
+	})
+
+	allow := newStore()
+	for _, i := range order {
+		path := paths[i]
+		allowed := map[string]bool{OPTIONS: true}
+		for _, method := range methods[keys[i]] {
+			allowed[method] = true
+		}
+		exact := true
+		for method, store := range stores {
+			if allowed[method] {
+				continue
+			}
+			if matchesAll(store, wildcards[method], path) {
+				allowed[method] = true
+			} else if exact {
+				exact = !matchesSome(table, host, method, path)
+			}
+		}
+		allow.Add(path, &allowHeader{value: allowValue(allowed), exact: exact})
+	}
+	return allow
+}
+
+// allowValue returns the Allow header listing the allowed methods, plus HEAD if GET is allowed.
+func allowValue(allowed map[string]bool) string {
+	if allowed[GET] {
+		allowed[HEAD] = true
+	}
+	ms := make([]string, 0, len(allowed))
+	for method := range allowed {
+		ms = append(ms, method)
+	}
+	sort.Strings(ms)
+	return strings.Join(ms, ", ")
+}
+
+// specificity ranks a path pattern: the fewer parameters, the more specific, and wildcards come last.
+func specificity(path string) int {
+	n := strings.Count(path, "<")
+	if strings.HasSuffix(path, "<:.*>") {
+		n += 1 << 16
+	}
+	return n
+}
+
+// matchesAll returns whether a route store matches all the requests of a path pattern.
+// Only the patterns whose parameters match a few literals, and the wildcard routes of the store,
+// given by their prefixes, are taken into account.
+func matchesAll(store routeStore, wildcards []string, path string) bool {
+	if paths := expandLiterals(path); paths != nil {
+		for _, p := range paths {
+			if data, _ := store.Get(p, nil); data == nil {
+				return false
+			}
+		}
+		return true
+	}
+	prefix := path[:strings.IndexByte(path, '<')]
+	for _, p := range wildcards {
+		if strings.HasPrefix(prefix, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSome returns whether the routes of a method registered for the host may match some of
+// the requests of a path pattern. The literal paths are not taken into account, as their own
+// Allow header is more specific.
+func matchesSome(table []routeEntry, host *hostRoutes, method, path string) bool {
+	for _, entry := range table {
+		if entry.method == method && entry.route.group.host == host && strings.Contains(entry.path, "<") &&
+			overlaps(entry.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps returns whether two path patterns may match a common path. It errs on the side of
+// overlapping: the patterns are told apart by their literal segments, or by their static prefixes
+// if a parameter may match a slash.
+func overlaps(p, q string) bool {
+	ps, qs := splitSegments(p), splitSegments(q)
+	if ps == nil || qs == nil {
+		p, q = p[:strings.IndexByte(p+"<", '<')], q[:strings.IndexByte(q+"<", '<')]
+		return strings.HasPrefix(p, q) || strings.HasPrefix(q, p)
+	}
+	if len(ps) != len(qs) {
+		return false
+	}
+	for i := range ps {
+		if ps[i] != qs[i] && !strings.Contains(ps[i], "<") && !strings.Contains(qs[i], "<") {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSegments splits a path pattern into its segments, or returns nil if a parameter may match a slash.
+func splitSegments(path string) []string {
+	var segments []string
+	start, param := 0, -1
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '<' && param < 0:
+			param = i
+		case path[i] == '>' && param >= 0:
+			if j := strings.IndexByte(path[param:i], ':'); j >= 0 {
+				re, err := syntax.Parse(path[param+j+1:i], syntax.Perl)
+				if err != nil || matchesSlash(re) {
+					return nil
+				}
+			}
+			param = -1
+		case path[i] == '/' && param < 0:
+			segments = append(segments, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// matchesSlash returns whether a regular expression may match a slash.
+func matchesSlash(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '/' {
+				return true
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '/' && '/' <= re.Rune[i+1] {
+				return true
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if matchesSlash(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns the Allow header of the request path for host, or "" if no route matches it.
+// It makes no allocations, unless the methods allowed for the path depend on the request.
+func (r *routing) allowed(host []byte, path string) string {
+	allow := r.allow
+	if r.hostStore != nil {
+		if data, _ := r.hostStore.Get(hostname(host), nil); data != nil {
+			allow = data.(*hostRoutes).allow
+		}
+	}
+	if allow == nil {
+		return ""
+	}
+	data, _ := allow.Get(path, nil)
+	if data == nil {
+		return ""
+	}
+	if header := data.(*allowHeader); header.exact {
+		return header.value
+	}
+	return r.findAllowed(host, path)
+}
+
+// findAllowed returns the Allow header of the request path for host, listing the methods of the routes matching it.
+func (r *routing) findAllowed(host []byte, path string) string {
+	pvalues := make([]string, r.maxParams)
+	stores, hnames := r.storesFor(host, pvalues)
+	allowed := map[string]bool{OPTIONS: true}
+	for method, store := range stores {
+		if data, _ := store.Get(path, pvalues[len(hnames):]); data != nil {
+			allowed[method] = true
+		}
+	}
+	return allowValue(allowed)
+}
+
+// dropBody drops the body of the response to a HEAD request, keeping its Content-Length.
+func dropBody(resp *fasthttp.Response) {
+	if !resp.IsBodyStream() {
+		resp.Header.SetContentLength(len(resp.Body()))
+		resp.ResetBody()
+	}
+	resp.SkipBody = true
+}
@@ -0,0 +1,146 @@
+package macross
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAutomaticHead(t *testing.T) {
+	m := New()
+	m.Get("/users", func(c *Context) error {
+		c.Response.Header.Set("X-Route", "GET")
+		return c.String("users")
+	})
+	m.Get("/posts", func(c *Context) error { return c.String("posts") })
+	m.Head("/posts", func(c *Context) error {
+		c.Response.Header.Set("X-Route", "HEAD")
+		return nil
+	})
+	m.Post("/comments", func(c *Context) error { return c.String("comments") })
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(HEAD)
+	ctx.Request.SetRequestURI("/users")
+	m.ServeHTTP(ctx)
+	assert.Equal(t, StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "GET", string(ctx.Response.Header.Peek("X-Route")))
+	assert.Equal(t, "", string(ctx.Response.Body()))
+	assert.Equal(t, 5, ctx.Response.Header.ContentLength())
+	response := ctx.Response.String()
+	assert.Contains(t, response, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(response, "\r\n\r\n"), response)
+
+	status, _, _ := serveHost(m, HEAD, "", "/posts")
+	assert.Equal(t, StatusOK, status)
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(HEAD)
+	ctx.Request.SetRequestURI("/posts")
+	m.ServeHTTP(ctx)
+	assert.Equal(t, "HEAD", string(ctx.Response.Header.Peek("X-Route")))
+
+	status, _, allow := serveHost(m, HEAD, "", "/comments")
+	assert.Equal(t, StatusMethodNotAllowed, status)
+	assert.Equal(t, "OPTIONS, POST", allow)
+
+	status, _, _ = serveHost(m, HEAD, "", "/missing")
+	assert.Equal(t, StatusNotFound, status)
+}
+
+func TestAutomaticOptions(t *testing.T) {
+	h := func(c *Context) error { return c.String(string(c.Method())) }
+	m := New()
+	m.Use(func(c *Context) error {
+		c.Response.Header.Set("X-Middleware", "yes")
+		return nil
+	})
+	m.NotFound(NotFoundHandler)
+	m.Get("/users", h)
+	m.Get("/users/<id>", h)
+	m.Post("/users/new", h)
+	m.Get("/files/*", h)
+	m.Put("/files/<name>/raw", h)
+	m.Delete("/<kind:posts|pages>/<id>", h)
+	m.Options("/custom", h)
+	m.Host("api.example.com").Patch("/users", h)
+
+	tests := []struct {
+		method, host, path string
+		status             int
+		allow              string
+	}{
+		{OPTIONS, "", "/users", StatusOK, "GET, HEAD, OPTIONS"},
+		{OPTIONS, "", "/users/5", StatusOK, "GET, HEAD, OPTIONS"},
+		{OPTIONS, "", "/users/new", StatusOK, "GET, HEAD, OPTIONS, POST"},
+		{OPTIONS, "", "/files/a/raw", StatusOK, "GET, HEAD, OPTIONS, PUT"},
+		{OPTIONS, "", "/posts/1", StatusOK, "DELETE, OPTIONS"},
+		{OPTIONS, "", "/custom", StatusOK, ""},
+		{OPTIONS, "", "/missing", StatusNotFound, ""},
+		{OPTIONS, "api.example.com", "/users", StatusOK, "OPTIONS, PATCH"},
+		{POST, "", "/users", StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		ctx.Request.Header.SetHost(test.host)
+		m.ServeHTTP(ctx)
+		id := test.method + " " + test.host + test.path
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), id)
+		assert.Equal(t, test.allow, string(ctx.Response.Header.Peek(HeaderAllow)), id)
+		assert.Equal(t, "yes", string(ctx.Response.Header.Peek("X-Middleware")), id)
+	}
+}
+
+func TestMethodNotAllowedAllow(t *testing.T) {
+	h := func(c *Context) error { return nil }
+	m := New()
+	m.Get("/users/<id>", h)
+	m.Delete("/users/<id>", h)
+	m.Post("/users/new", h)
+
+	status, _, allow := serveHost(m, PUT, "", "/users/new")
+	assert.Equal(t, StatusMethodNotAllowed, status)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, POST", allow)
+
+	status, _, allow = serveHost(m, PUT, "", "/users/5")
+	assert.Equal(t, StatusMethodNotAllowed, status)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", allow)
+}
+
+func TestOverlappingAllow(t *testing.T) {
+	h := func(c *Context) error { return nil }
+	m := New()
+	m.Get(`/users/<id:\d+>`, h)
+	m.Post("/users/<id>", h)
+	m.Put("/users/<id>/name", h)
+	m.Get("/pages/<id>", h)
+	m.Delete("/<kind:posts|pages>/<id>", h)
+	m.Patch("/files/<path:.+>", h)
+	m.Put("/files/<name>", h)
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{OPTIONS, "/users/5", "GET, HEAD, OPTIONS, POST"},
+		{PUT, "/users/5", "GET, HEAD, OPTIONS, POST"},
+		{OPTIONS, "/users/ann", "OPTIONS, POST"},
+		{OPTIONS, "/users/5/name", "OPTIONS, PUT"},
+		{OPTIONS, "/pages/1", "DELETE, GET, HEAD, OPTIONS"},
+		{OPTIONS, "/posts/1", "DELETE, OPTIONS"},
+		{OPTIONS, "/files/a", "OPTIONS, PATCH, PUT"},
+		{OPTIONS, "/files/a/b", "OPTIONS, PATCH"},
+	}
+	for _, test := range tests {
+		_, _, allow := serveHost(m, test.method, "", test.path)
+		assert.Equal(t, test.allow, allow, test.method+" "+test.path)
+	}
+
+	assert.True(t, overlaps("/users/<id>", `/users/<id:\d+>`))
+	assert.False(t, overlaps("/users/<id>", "/users/<id>/name"))
+	assert.False(t, overlaps("/users/<id>", "/posts/<id>"))
+	assert.True(t, overlaps("/files/<path:.+>", "/files/<name>/raw"))
+	assert.False(t, overlaps("/files/<path:.+>", "/users/<id>"))
+}
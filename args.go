@@ -3,12 +3,15 @@ package macross
 import (
 	"github.com/insionng/macross/libraries/com"
 	"strconv"
+	"strings"
 	"time"
+	"unsafe"
 )
 
 type (
 	Args struct {
 		s string
+		v interface{}
 	}
 )
 
@@ -59,8 +62,10 @@ func (a *Args) Int64() (int64, error) {
 	return com.StrTo(a.s).Int64()
 }
 
+// String returns the value as a string.
+// The value of a route parameter points into the request, so it is copied.
 func (a *Args) String() string {
-	return com.StrTo(a.s).String()
+	return strings.Clone(com.StrTo(a.s).String())
 }
 
 func (a *Args) Bytes() []byte {
@@ -72,12 +77,21 @@ func (a *Args) Time() time.Time {
 	return tme
 }
 
+// Value returns the value of a typed route parameter converted by its ParamType,
+// such as an int for "<id:int>". Otherwise it returns the value as a string.
+func (a *Args) Value() interface{} {
+	if a.v != nil {
+		return a.v
+	}
+	return a.String()
+}
+
 func (a *Args) Exist() bool {
 	return com.StrTo(a.s).Exist()
 }
 
 func (a *Args) ToStr(args ...int) (s string) {
-	return com.ToStr(a.s, args...)
+	return strings.Clone(com.ToStr(a.s, args...))
 }
 
 func (a *Args) ToSnakeCase(str ...string) string {
@@ -94,13 +108,23 @@ func (a *Args) ToSnakeCase(str ...string) string {
 
 // Param returns the named parameter value that is found in the URL path matching the current route.
 // If the named parameter cannot be found, an empty string will be returned.
+// The value of a typed parameter, such as "<id:int>", is also available converted through `Args#Value()`.
+// The returned Args is owned by the context and must not be used once the request is handled.
 func (c *Context) Param(name string) *Args {
-	var a = new(Args)
-	for i, n := range c.pnames {
-		if n == name {
-			a.s = c.pvalues[i]
-		}
+	if len(c.args) <= len(c.pnames) {
+		c.args = make([]Args, len(c.pnames)+1)
 	}
+	i := len(c.pnames) - 1
+	for ; i >= 0 && c.pnames[i] != name; i-- {
+	}
+	if i < 0 {
+		// the Args after those of the parameters is for missing parameters
+		a := &c.args[len(c.pnames)]
+		*a = Args{}
+		return a
+	}
+	a := &c.args[i]
+	a.s, a.v = c.pvalues[i], c.params[name]
 	return a
 }
 
@@ -122,7 +146,7 @@ func (c *Context) Args(key ...string) *Args {
 		k = key[0]
 		for i, n := range c.pnames {
 			if n == k {
-				a.s = c.pvalues[i]
+				a.s = strings.Clone(c.pvalues[i])
 			}
 		}
 		if len(a.s) == 0 {
@@ -135,11 +159,17 @@ func (c *Context) Args(key ...string) *Args {
 func (c *Context) Parameter(i int) (value string) {
 	l := len(c.pnames)
 	if i < l {
-		value = c.pvalues[i]
+		value = strings.Clone(c.pvalues[i])
 	}
 	return
 }
 
+// b2s converts a byte slice to a string without copying it.
+// The string must not be used once the byte slice is modified.
+func b2s(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
 // QueryParam implements `Context#QueryParam` function.
 func (c *Context) QueryParam(name string) string {
 	return string(c.QueryArgs().Peek(name))
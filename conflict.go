@@ -0,0 +1,289 @@
+package macross
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp/syntax"
+	"runtime"
+	"strings"
+)
+
+// maxLiterals is the maximum number of paths a route with literal parameter patterns,
+// such as "<action:new|edit>", is expanded into to check whether it is reachable.
+const maxLiterals = 64
+
+// packageDir is the directory of the package source, used to skip its frames when looking up
+// the code registering a route.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// SetStrictRouting sets how route conflicts are reported. A route conflicts with the routes registered
+// before it if it has the same method, host and path pattern, or if they always match its requests
+// first, such as "/users/new" registered after "/users/<id>". In strict routing mode, registering
+// a conflicting route panics. Otherwise a warning is logged. Both report where the routes were registered.
+func (r *Macross) SetStrictRouting(strict bool) {
+	r.strictRouting = strict
+}
+
+// checkConflicts reports the conflicts of a route with the routes registered before it.
+// The path of the route has its parameter types expanded.
+func (r *Macross) checkConflicts(route *Route, method, path, source string) {
+	if i, exists := r.tableIndex[routeKey(route.group.host, method, path)]; exists {
+		r.conflict(fmt.Sprintf("%v duplicates %v", describeRoute(method, route, source), r.table[i].String()))
+	} else if entry := r.shadowing(route.group.host, method, path); entry != nil {
+		r.conflict(fmt.Sprintf("%v is unreachable: %v matches its requests first", describeRoute(method, route, source), entry.String()))
+	}
+}
+
+// conflict panics in strict routing mode and logs a warning otherwise.
+func (r *Macross) conflict(msg string) {
+	if r.strictRouting {
+		panic("macross: route conflict: " + msg)
+	}
+	log.Printf("macross: route conflict: %s", msg)
+}
+
+// shadowing returns the first registered route that matches all the requests of a route
+// with the given method and path on the host, or nil if there is none.
+func (r *Macross) shadowing(host *hostRoutes, method, path string) *routeEntry {
+	if paths := expandLiterals(path); paths != nil {
+		stores := r.stores
+		if host != nil {
+			stores = host.stores
+		}
+		store := stores[method]
+		if store == nil {
+			return nil
+		}
+		pvalues := make([]string, r.maxParams)
+		for _, p := range paths {
+			if data, _ := store.Get(p, pvalues); data == nil {
+				return nil
+			}
+		}
+		// the route store does not tell which route matched: find the first one matching alone
+		for i := range r.table {
+			entry := &r.table[i]
+			if entry.method != method || entry.route.group.host != host {
+				continue
+			}
+			s := newStore()
+			s.Add(entry.path, true)
+			if data, _ := s.Get(paths[0], pvalues); data != nil {
+				return entry
+			}
+		}
+		return nil
+	}
+
+	// a route with open parameters is checked against the wildcard routes matching its static prefix,
+	// and the routes matching all its segments, such as "/users/<name>" for "/users/<id:\d+>"
+	prefix := path
+	if i := strings.IndexByte(path, '<'); i >= 0 {
+		prefix = path[:i]
+	}
+	segments := splitSegments(path)
+	for i := range r.table {
+		entry := &r.table[i]
+		if entry.method != method || entry.route.group.host != host {
+			continue
+		}
+		if p := strings.TrimSuffix(entry.path, "<:.*>"); p != entry.path && !strings.Contains(p, "<") && strings.HasPrefix(prefix, p) {
+			return entry
+		}
+		if segments != nil && coversSegments(splitPattern(entry.path), segments) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// coversSegments returns whether the segments of a path pattern match all the paths matched by
+// the given segments, whose parameters do not match slashes: each of its segments is the same
+// or a parameter matching any segment.
+func coversSegments(covering, segments []string) bool {
+	if len(covering) != len(segments) {
+		return false
+	}
+	for i, segment := range covering {
+		if segment != segments[i] && !anySegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// anySegment returns whether a path pattern segment is a parameter matching any segment,
+// such as "<id>" or "<path:.*>".
+func anySegment(segment string) bool {
+	if !strings.HasPrefix(segment, "<") || strings.IndexByte(segment, '>') != len(segment)-1 {
+		return false
+	}
+	i := strings.IndexByte(segment, ':')
+	if i < 0 {
+		return true
+	}
+	pattern := segment[i+1 : len(segment)-1]
+	return pattern == "[^/]*" || pattern == ".*"
+}
+
+// splitPattern splits a path pattern into its segments, without splitting the parameter patterns.
+func splitPattern(path string) []string {
+	var segments []string
+	start, param := 0, false
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '<' && !param:
+			param = true
+		case path[i] == '>' && param:
+			param = false
+		case path[i] == '/' && !param:
+			segments = append(segments, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// String describes the route entry with the code that registered it.
+func (e *routeEntry) String() string {
+	return describeRoute(e.method, e.route, e.source)
+}
+
+func describeRoute(method string, route *Route, source string) string {
+	s := method + " " + route.group.hostPattern() + route.path
+	if source != "" {
+		s += " (" + source + ")"
+	}
+	return s
+}
+
+// routeKey identifies the routes of a method and a host with the same path pattern,
+// regardless of the parameter names.
+func routeKey(host *hostRoutes, method, path string) string {
+	key := method + " "
+	if host != nil {
+		key += host.pattern
+	}
+	for {
+		start := strings.IndexByte(path, '<')
+		end := strings.IndexByte(path, '>')
+		if start < 0 || end < start {
+			return key + path
+		}
+		pattern := "[^/]*"
+		if i := strings.IndexByte(path[start:end], ':'); i >= 0 {
+			pattern = path[start+i+1 : end]
+		}
+		key += path[:start] + "<:" + pattern + ">"
+		path = path[end+1:]
+	}
+}
+
+// expandLiterals returns the paths matched by a path pattern whose parameters only match a few literals,
+// or nil if the pattern matches an open set of paths.
+func expandLiterals(path string) []string {
+	paths, start, colon := []string{""}, -1, -1
+	last := 0
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '<' && start < 0:
+			start, colon = i, -1
+		case path[i] == ':' && start >= 0 && colon < 0:
+			colon = i
+		case path[i] == '>' && start >= 0:
+			if colon < 0 {
+				return nil
+			}
+			re, err := syntax.Parse(path[colon+1:i], syntax.Perl)
+			if err != nil {
+				return nil
+			}
+			values := literals(re.Simplify())
+			if values == nil || len(paths)*len(values) > maxLiterals {
+				return nil
+			}
+			paths = product(paths, path[last:start], values)
+			last, start = i+1, -1
+		}
+	}
+	return product(paths, path[last:], []string{""})
+}
+
+// literals returns the strings matched by a regular expression that only matches a few literals,
+// or nil otherwise.
+func literals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil
+		}
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass:
+		var values []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for c := re.Rune[i]; c <= re.Rune[i+1]; c++ {
+				if len(values) == maxLiterals {
+					return nil
+				}
+				values = append(values, string(c))
+			}
+		}
+		return values
+	case syntax.OpCapture:
+		return literals(re.Sub[0])
+	case syntax.OpAlternate:
+		var values []string
+		for _, sub := range re.Sub {
+			v := literals(sub)
+			if v == nil || len(values)+len(v) > maxLiterals {
+				return nil
+			}
+			values = append(values, v...)
+		}
+		return values
+	case syntax.OpConcat:
+		values := []string{""}
+		for _, sub := range re.Sub {
+			v := literals(sub)
+			if v == nil || len(values)*len(v) > maxLiterals {
+				return nil
+			}
+			values = product(values, "", v)
+		}
+		return values
+	}
+	return nil
+}
+
+// product returns the strings made of a prefix, the separator and a suffix, for all the prefixes and suffixes.
+func product(prefixes []string, sep string, suffixes []string) []string {
+	values := make([]string, 0, len(prefixes)*len(suffixes))
+	for _, p := range prefixes {
+		for _, s := range suffixes {
+			values = append(values, p+sep+s)
+		}
+	}
+	return values
+}
+
+// callerSource returns the file and line of the code registering a route,
+// which is the first caller outside of the package.
+func callerSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%v:%v", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
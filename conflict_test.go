@@ -0,0 +1,118 @@
+package macross
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteConflicts(t *testing.T) {
+	h := func(c *Context) error { return nil }
+	tests := []struct {
+		id       string
+		register func(m *Macross)
+		conflict string
+	}{
+		{"same path", func(m *Macross) {
+			m.Get("/users", h)
+			m.Get("/users", h)
+		}, "GET /users (conflict_test.go:23) duplicates GET /users (conflict_test.go:22)"},
+		{"same pattern", func(m *Macross) {
+			m.Get("/users/<id>", h)
+			m.Get("/users/<name:[^/]*>", h)
+		}, "duplicates GET /users/<id>"},
+		{"same type", func(m *Macross) {
+			m.Get("/users/<id:int>", h)
+			m.Group("/users").Get("/<n:-?[0-9]+>", h)
+		}, "duplicates GET /users/<id:int>"},
+		{"param first", func(m *Macross) {
+			m.Get("/users/<id>", h)
+			m.Get("/users/new", h)
+		}, "GET /users/new (conflict_test.go:35) is unreachable: GET /users/<id> (conflict_test.go:34) matches its requests first"},
+		{"static first", func(m *Macross) {
+			m.Get("/users/new", h)
+			m.Get("/users/edit", h)
+			m.Get("/users/<id>", h)
+			m.Get("/users/<action:new|edit>", h)
+		}, "GET /users/<action:new|edit> (conflict_test.go:41) is unreachable: GET /users/new (conflict_test.go:38) matches its requests first"},
+		{"default param first", func(m *Macross) {
+			m.Get("/users/<name>", h)
+			m.Get("/users/<id:[0-9]+>", h)
+		}, "GET /users/<id:[0-9]+> (conflict_test.go:45) is unreachable: GET /users/<name> (conflict_test.go:44) matches its requests first"},
+		{"any segment first", func(m *Macross) {
+			m.Get("/users/<name:[^/]*>/posts/<post>", h)
+			m.Get("/users/<id:int>/posts/<slug:slug>", h)
+		}, "is unreachable: GET /users/<name:[^/]*>/posts/<post>"},
+		{"wildcard", func(m *Macross) {
+			m.Get("/files/*", h)
+			m.Get("/files/<id>/raw", h)
+		}, "is unreachable: GET /files/<:.*>"},
+		{"host", func(m *Macross) {
+			m.Host("api.example.com").Get("/users/<id>", h)
+			m.Host("api.example.com").Get("/users/me", h)
+		}, "GET api.example.com/users/me"},
+		{"no conflict", func(m *Macross) {
+			m.Get("/users/new", h)
+			m.Get("/users/<id:\\d+>", h)
+			m.Get("/users/<action:new|edit>", h)
+			m.Post("/users/<id>", h)
+			m.Post("/users/<id>/edit", h)
+			m.Get("/files/<id>", h)
+			m.Get("/files/*", h)
+			m.Get("/posts/<id:\\d+>", h)
+			m.Get("/posts/<slug>", h)
+			m.Get("/posts/<slug>/<page:\\d+>/raw", h)
+			m.Get("/posts/<slug>/<page>", h)
+			m.Host("api.example.com").Get("/users/new", h)
+			m.Host("<tenant>.example.com").Get("/users/new", h)
+		}, ""},
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	for _, test := range tests {
+		buf.Reset()
+		test.register(New())
+		if test.conflict == "" {
+			assert.Equal(t, "", buf.String(), test.id)
+			continue
+		}
+		assert.Contains(t, strings.Replace(buf.String(), packageDir+"/", "", -1), test.conflict, test.id)
+
+		m := New()
+		m.SetStrictRouting(true)
+		assert.Panics(t, func() { test.register(m) }, test.id)
+	}
+}
+
+func TestStrictRoutingPanic(t *testing.T) {
+	m := New()
+	m.SetStrictRouting(true)
+	m.Get("/users/<id>", func(c *Context) error { return nil })
+	defer func() {
+		msg := fmt.Sprint(recover())
+		assert.True(t, strings.HasPrefix(msg, "macross: route conflict: GET /users/new ("+packageDir+"/conflict_test.go:"), msg)
+	}()
+	m.Get("/users/new", func(c *Context) error { return nil })
+}
+
+func TestRouteKey(t *testing.T) {
+	assert.Equal(t, "GET /users/<:[^/]*>/<:\\d+>/<:.*>", routeKey(nil, GET, "/users/<id>/<n:\\d+>/<:.*>"))
+	assert.Equal(t, "POST api.example.com/users", routeKey(&hostRoutes{pattern: "api.example.com"}, POST, "/users"))
+}
+
+func TestExpandLiterals(t *testing.T) {
+	assert.Equal(t, []string{"/users"}, expandLiterals("/users"))
+	assert.Equal(t, []string{"/users/new", "/users/edit"}, expandLiterals("/users/<action:new|edit>"))
+	assert.Equal(t, []string{"/v1/a", "/v1/b", "/v2/a", "/v2/b"}, expandLiterals("/v<v:[12]>/<x:(a|b)>"))
+	assert.Nil(t, expandLiterals("/users/<id>"))
+	assert.Nil(t, expandLiterals("/users/<id:\\d+>"))
+	assert.Nil(t, expandLiterals("/users/<:.*>"))
+	assert.Nil(t, expandLiterals("/users/<name:(?i)root>"))
+}
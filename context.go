@@ -31,11 +31,16 @@ type (
 		Localer
 		Flash    *Flash
 		macross  *Macross
+		prefix   string                 // the path prefix the macross is mounted at
+		path     []byte                 // the path the request is routed with, which the parameter values point into
 		pnames   []string               // list of route parameter names
 		pvalues  []string               // list of parameter values corresponding to pnames
+		args     []Args                 // the Args returned by Param, one per parameter plus one for missing parameters
+		params   map[string]interface{} // the converted values of the typed parameters by name
 		data     map[string]interface{} // data items managed by Get , Set , GetStore and SetStore
 		index    int                    // the index of the currently executing handler in handlers
 		handlers []Handler              // the handlers associated with the current route
+		produced string                 // the media type of the response negotiated among those the route produces
 	}
 
 	// Localer reprents a localization interface.
@@ -58,6 +63,8 @@ func (c *Context) Reset(ctx *fasthttp.RequestCtx) {
 	c.RequestCtx = ctx
 	c.ktx = ktx.Background()
 	c.data = nil
+	c.params = nil
+	c.produced = ""
 	c.index = -1
 	c.Serialize = Serialize
 }
@@ -168,7 +175,8 @@ func (c *Context) GetStore() map[string]interface{} {
 // are executed.
 func (c *Context) Next() error {
 	c.index++
-	for n := len(c.handlers); c.index < n; c.index++ {
+	// the handlers may be replaced by those of another route while they run, see Route#Produces
+	for ; c.index < len(c.handlers); c.index++ {
 		if err := c.handlers[c.index](c); err != nil {
 			return err
 		}
@@ -199,10 +207,11 @@ func (c *Context) Break(status int, err ...error) error {
 // The parameters should be given in the sequence of name1, value1, name2, value2, and so on.
 // If a parameter in the route is not provided a value, the parameter token will remain in the resulting URL.
 // Parameter values will be properly URL encoded.
+// For a macross mounted on another one, the URL starts with the mount prefix.
 // The method returns an empty string if the URL creation fails.
 func (c *Context) URL(route string, pairs ...interface{}) string {
-	if r := c.macross.routes[route]; r != nil {
-		return r.URL(pairs...)
+	if r := c.macross.currentRouting().routes[route]; r != nil {
+		return c.prefix + r.URL(pairs...)
 	}
 	return ""
 }
@@ -12,10 +12,13 @@ var (
 	ErrStatusBadRequest            = NewHTTPError(StatusBadRequest)
 	ErrUnauthorized                = NewHTTPError(StatusUnauthorized)
 	ErrMethodNotAllowed            = NewHTTPError(StatusMethodNotAllowed)
+	ErrNotAcceptable               = NewHTTPError(StatusNotAcceptable)
 	ErrStatusRequestEntityTooLarge = NewHTTPError(StatusRequestEntityTooLarge)
 	ErrRendererNotRegistered       = errors.New("renderer not registered")
 	ErrInvalidRedirectCode         = errors.New("invalid redirect status code")
 	ErrCookieNotFound              = errors.New("cookie not found")
+	ErrServerClosed                = errors.New("server closed")
+	ErrInvalidProxyHeader          = errors.New("invalid PROXY protocol header")
 )
 
 // Error contains the error information reported by calling Context.Error().
@@ -0,0 +1,215 @@
+package macross
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type (
+	// TrustedProxyConfig defines the reverse proxies allowed to report the client address,
+	// scheme and host through the X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host
+	// and X-Real-IP headers, or through the Forwarded header.
+	TrustedProxyConfig struct {
+		// TrustedCIDRs lists the networks of the trusted proxies, e.g. "10.0.0.0/8" or a single address.
+		TrustedCIDRs []string `json:"trusted_cidrs"`
+
+		// Hops is the number of proxies in front of the macross that are trusted whatever
+		// their address, e.g. 1 behind a cloud load balancer or a web server on a unix socket.
+		Hops int `json:"hops"`
+
+		// Header is the header the trusted proxies append the client addresses to: X-Forwarded-For,
+		// with X-Real-IP as fallback, or Forwarded. The other one is ignored, since the client may send it.
+		// Optional. Default value "X-Forwarded-For".
+		Header string `json:"header"`
+	}
+
+	// trustedProxies is the parsed form of a TrustedProxyConfig.
+	trustedProxies struct {
+		networks  []*net.IPNet
+		hops      int
+		forwarded bool // whether the proxies report the client addresses in the Forwarded header
+	}
+
+	// forwardedHop is what a proxy reported about the request it received.
+	forwardedHop struct {
+		addr  string // the address of the peer of the proxy, without port
+		proto string
+		host  string
+	}
+)
+
+// SetTrustedProxies configures which reverse proxies are trusted by `Context#RealIP()`,
+// `Context#Scheme()` and `Context#Host()`. The forwarding headers are ignored for requests
+// that do not come from a trusted proxy, which is the case for all requests by default.
+//
+// The forwarded addresses are read from right to left: the client is the first address
+// that is not a trusted proxy. Only the header set by `TrustedProxyConfig.Header` is read,
+// either X-Forwarded-For or the standard Forwarded header (RFC 7239).
+// The trusted proxies are read by every request, so setting them on a frozen macross panics.
+func (m *Macross) SetTrustedProxies(config TrustedProxyConfig) error {
+	m.checkNotFrozen("set the trusted proxies")
+	networks, err := parseCIDRs(config.TrustedCIDRs)
+	if err != nil {
+		return err
+	}
+	forwarded := strings.EqualFold(config.Header, HeaderForwarded)
+	if !forwarded && config.Header != "" && !strings.EqualFold(config.Header, HeaderXForwardedFor) {
+		return errors.New("unsupported forwarding header " + config.Header)
+	}
+	m.proxies = trustedProxies{networks: networks, hops: config.Hops, forwarded: forwarded}
+	return nil
+}
+
+// trusts reports whether the proxy at the given distance from the macross is trusted,
+// the peer of the macross being at distance 0.
+func (p *trustedProxies) trusts(ip net.IP, hop int) bool {
+	return hop < p.hops || (ip != nil && containsIP(p.networks, ip))
+}
+
+// forwarded returns what the outermost trusted proxy reported about the client request.
+// It returns false if the peer is not a trusted proxy or no forwarding header was sent.
+func (c *Context) forwarded() (forwardedHop, bool) {
+	proxies := &c.macross.proxies
+	var peer net.IP
+	if addr, okay := c.RemoteAddr().(*net.TCPAddr); okay {
+		peer = addr.IP
+	}
+	if !proxies.trusts(peer, 0) {
+		return forwardedHop{}, false
+	}
+
+	hops := c.forwardedHops()
+	if len(hops) == 0 {
+		return forwardedHop{}, false
+	}
+	for i := len(hops) - 1; i > 0; i-- {
+		if !proxies.trusts(net.ParseIP(hops[i].addr), len(hops)-i) {
+			return hops[i], true
+		}
+	}
+	return hops[0], true
+}
+
+// forwardedHops parses the forwarding headers of the trusted proxies, the nearest proxy last.
+func (c *Context) forwardedHops() []forwardedHop {
+	if c.macross.proxies.forwarded {
+		return parseForwarded(c.headerValues(HeaderForwarded))
+	}
+
+	addrs := c.headerValues(HeaderXForwardedFor)
+	if len(addrs) == 0 {
+		addrs = c.headerValues(HeaderXRealIP)
+	}
+	protos := c.headerValues(HeaderXForwardedProto)
+	hosts := c.headerValues(HeaderXForwardedHost)
+	n := len(addrs)
+	if n == 0 && len(protos)+len(hosts) > 0 {
+		n = 1
+	}
+
+	// Proxies append to the headers in turn, so the values are aligned from the left.
+	// A proxy that does not append reports the same scheme and host as the previous one.
+	hops := make([]forwardedHop, n)
+	for i := range hops {
+		if i < len(addrs) {
+			hops[i].addr = stripPort(addrs[i])
+		}
+		if len(protos) > 0 {
+			hops[i].proto = strings.ToLower(protos[minInt(i, len(protos)-1)])
+		}
+		if len(hosts) > 0 {
+			hops[i].host = hosts[minInt(i, len(hosts)-1)]
+		}
+	}
+	return hops
+}
+
+// headerValues returns the comma-separated values of all the request headers with the given key.
+func (c *Context) headerValues(key string) []string {
+	var values []string
+	c.Request.Header.VisitAll(func(k, v []byte) {
+		if strings.EqualFold(string(k), key) {
+			for _, value := range splitQuoted(string(v), ',') {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+	})
+	return values
+}
+
+// parseForwarded parses the elements of Forwarded headers, such as
+// `for=192.0.2.60;proto=https;host=example.com, for="[2001:db8::1]:4711"`.
+func parseForwarded(elements []string) []forwardedHop {
+	hops := make([]forwardedHop, 0, len(elements))
+	for _, element := range elements {
+		var hop forwardedHop
+		for _, pair := range splitQuoted(element, ';') {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				continue
+			}
+			value := unquote(strings.TrimSpace(pair[i+1:]))
+			switch strings.ToLower(strings.TrimSpace(pair[:i])) {
+			case "for":
+				hop.addr = stripPort(value)
+			case "proto":
+				hop.proto = strings.ToLower(value)
+			case "host":
+				hop.host = value
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// splitQuoted splits s around sep, except inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripPort returns the host of addr, which may or may not have a port.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
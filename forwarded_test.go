@@ -0,0 +1,105 @@
+package macross
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RealIP() + " " + c.Scheme() + " " + c.Host())
+	})
+	assert.Nil(t, m.SetTrustedProxies(TrustedProxyConfig{TrustedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}}))
+	assert.NotNil(t, m.SetTrustedProxies(TrustedProxyConfig{TrustedCIDRs: []string{"10.0.0.0/40"}}))
+
+	tests := []struct {
+		id      string
+		peer    string
+		headers map[string]string
+		expect  string
+	}{
+		{"untrusted peer", "192.0.2.1", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https"}, "192.0.2.1 http example.com"},
+		{"no header", "10.0.0.1", nil, "10.0.0.1 http example.com"},
+		{"single hop", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"}, "198.51.100.1 https api.example.com"},
+		{"spoofed chain", "10.0.0.1", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1 http example.com"},
+		{"all trusted", "10.0.0.1", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3 http example.com"},
+		{"ports and ipv6", "10.0.0.1", map[string]string{"X-Forwarded-For": "[2001:db8:1::1]:1234, 198.51.100.1:4711"}, "198.51.100.1 http example.com"},
+		{"real ip", "10.0.0.1", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1 http example.com"},
+		{"forwarded ignored", "10.0.0.1", map[string]string{"Forwarded": `for=6.6.6.6;host=evil.example.com`, "X-Forwarded-For": "198.51.100.7"}, "198.51.100.7 http example.com"},
+		{"proto only", "10.0.0.1", map[string]string{"X-Forwarded-Proto": "HTTPS"}, "10.0.0.1 https example.com"},
+	}
+	for _, test := range tests {
+		var req fasthttp.Request
+		req.SetRequestURI("http://example.com/")
+		for key, value := range test.headers {
+			req.Header.Set(key, value)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(test.peer), Port: 5000}, nil)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.expect, string(ctx.Response.Body()), test.id)
+	}
+	assert.Panics(t, func() { m.SetTrustedProxies(TrustedProxyConfig{Hops: 1}) }, "frozen on the first request")
+}
+
+func TestTrustedProxiesForwarded(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RealIP() + " " + c.Scheme() + " " + c.Host())
+	})
+	assert.NotNil(t, m.SetTrustedProxies(TrustedProxyConfig{Header: HeaderXRealIP}))
+	assert.Nil(t, m.SetTrustedProxies(TrustedProxyConfig{TrustedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}, Header: HeaderForwarded}))
+
+	tests := []struct {
+		id      string
+		headers map[string]string
+		expect  string
+	}{
+		{"forwarded", map[string]string{"Forwarded": `for=1.2.3.4, for=198.51.100.1;proto=https;host=api.example.com, for="[2001:db8::1]:4711";proto=http`}, "198.51.100.1 https api.example.com"},
+		{"forwarded quoted", map[string]string{"Forwarded": `For="[2001:db9::1]:4711";Host="a,b.example.com"`}, "2001:db9::1 http a,b.example.com"},
+		{"x-forwarded-for ignored", map[string]string{"X-Forwarded-For": "6.6.6.6", "X-Forwarded-Proto": "https"}, "10.0.0.1 http example.com"},
+	}
+	for _, test := range tests {
+		var req fasthttp.Request
+		req.SetRequestURI("http://example.com/")
+		for key, value := range test.headers {
+			req.Header.Set(key, value)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}, nil)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.expect, string(ctx.Response.Body()), test.id)
+	}
+}
+
+func TestTrustedProxiesHops(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RealIP())
+	})
+	m.SetTrustedProxies(TrustedProxyConfig{Hops: 2})
+
+	tests := []struct {
+		xff, expect string
+	}{
+		{"", "192.0.2.1"},
+		{"198.51.100.1", "198.51.100.1"},
+		{"198.51.100.1, 203.0.113.5", "198.51.100.1"},
+		{"1.2.3.4, 198.51.100.1, 203.0.113.5", "198.51.100.1"},
+	}
+	for _, test := range tests {
+		var req fasthttp.Request
+		req.SetRequestURI("http://example.com/")
+		if test.xff != "" {
+			req.Header.Set(HeaderXForwardedFor, test.xff)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}, nil)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.expect, string(ctx.Response.Body()), test.xff)
+	}
+}
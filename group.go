@@ -9,6 +9,8 @@ type RouteGroup struct {
 	prefix   string
 	macross  *Macross
 	handlers []Handler
+	host     *hostRoutes // the host the routes are bound to, nil for any host
+	name     string      // the name prefix of the nested resource routes, e.g. "users."
 }
 
 // newRouteGroup creates a new RouteGroup with the given path prefix, macross, and handlers.
@@ -20,6 +22,14 @@ func newRouteGroup(prefix string, macross *Macross, handlers []Handler) *RouteGr
 	}
 }
 
+// Path returns a route with the given route path, to which methods can then be added,
+// for example after declaring the media types they consume and produce:
+//
+//	m.Path("/users").Consumes(macross.MIMEApplicationJSON).Post(createUser)
+func (r *RouteGroup) Path(path string) *Route {
+	return newRoute(path, r)
+}
+
 // Get adds a GET route to the macross with the given route path and handlers.
 func (r *RouteGroup) Get(path string, handlers ...Handler) *Route {
 	return newRoute(path, r).Get(handlers...)
@@ -85,22 +95,63 @@ func (r *RouteGroup) To(methods, path string, handlers ...Handler) *Route {
 }
 
 // Group creates a RouteGroup with the given route path prefix and handlers.
-// The new group will combine the existing path prefix with the new one.
-// If no handler is provided, the new group will inherit the handlers registered
-// with the current group.
+// The new group will combine the existing path prefix with the new one, and its routes
+// will be served by the handlers of the current group followed by the given ones.
+// The current group is left unchanged: the given handlers only apply to the new group,
+// and the handlers registered with the current group afterwards do not apply to it.
 func (r *RouteGroup) Group(prefix string, handlers ...Handler) *RouteGroup {
-	if len(handlers) == 0 {
-		handlers = make([]Handler, len(r.handlers))
-		copy(handlers, r.handlers)
-	} else {
-		r.Use(handlers...)
+	group := newRouteGroup(r.prefix+prefix, r.macross, combineHandlers(r.handlers, handlers))
+	group.host, group.name = r.host, r.name
+	return group
+}
+
+// With creates a RouteGroup with the same path prefix as the current group and the given handlers
+// appended to its own. It is a shortcut for `Group("", handlers...)` to apply a few handlers to
+// some routes only, without changing the current group:
+//
+//	m.With(auth).Post("/posts", createPost)
+func (r *RouteGroup) With(handlers ...Handler) *RouteGroup {
+	return r.Group("", handlers...)
+}
+
+// Mount sends the requests whose path is the prefix or starts with the prefix followed by a slash
+// to the app, with the prefix stripped from the path. The app handles them with its own handlers,
+// NotFound handlers, binder, renderer, error handling and route names, after the handlers of
+// the group. The prefix may contain parameters.
+// Within the app, `Context#URL()` builds paths including the prefix, and the context carries
+// the data items, standard context, session, localer and flash set by the handlers of the group,
+// such as the identity of an authenticated user.
+func (r *RouteGroup) Mount(prefix string, app *Macross) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	app.parent = r.macross
+	if r.prefix+prefix != "" {
+		r.Any(prefix, mountHandler(app, false))
 	}
+	r.Any(prefix+"/*", mountHandler(app, true))
+}
 
-	return newRouteGroup(r.prefix+prefix, r.macross, r.handlers)
+// mountHandler returns a handler passing the request to the mounted app.
+// If wildcard is true, the route ends with a wildcard matching the rest of the path.
+func mountHandler(app *Macross, wildcard bool) Handler {
+	return func(c *Context) error {
+		uri := c.URI()
+		matched, rest := string(uri.Path()), "/"
+		if wildcard {
+			rest += c.Parameter(len(c.pnames) - 1)
+			matched = matched[:len(matched)-len(rest)]
+		}
+
+		original := append([]byte(nil), uri.PathOriginal()...)
+		uri.SetPath(rest)
+		app.handle(c.RequestCtx, c.prefix+matched, c)
+		uri.SetPathBytes(original)
+		return nil
+	}
 }
 
 // Use registers one or multiple handlers to the current route group.
-// These handlers will be shared by all routes belong to this group and its subgroups.
+// These handlers will be shared by the routes registered with this group and the subgroups
+// created from it afterwards.
 func (r *RouteGroup) Use(handlers ...Handler) {
 	r.handlers = append(r.handlers, handlers...)
 }
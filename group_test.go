@@ -2,9 +2,13 @@ package macross
 
 import (
 	"bytes"
+	ktx "context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
 )
 
 func TestRouteGroupTo(t *testing.T) {
@@ -77,6 +81,73 @@ func TestRouteGroupGroup(t *testing.T) {
 	g4 := group2.Group("", newHandler("3", &buf))
 	assert.Equal(t, "/admin", g4.prefix, "g4.prefix =")
 	assert.Equal(t, 3, len(g4.handlers), "len(g4.handlers) =")
+	assert.Equal(t, 2, len(group2.handlers), "len(group2.handlers) =")
+	assert.Equal(t, 2, len(g3.handlers), "len(g3.handlers) =")
+}
+
+func TestRouteGroupInheritance(t *testing.T) {
+	var buf bytes.Buffer
+	m := New()
+	m.Use(newHandler("m", &buf))
+	api := m.Group("/api", newHandler("a", &buf))
+	api.Get("/before", newHandler("1", &buf))
+	users := api.Group("/users", newHandler("u", &buf))
+	api.Use(newHandler("x", &buf))
+	users.Get("", newHandler("2", &buf))
+	api.Get("/after", newHandler("3", &buf))
+	api.With(newHandler("w", &buf)).Get("/with", newHandler("4", &buf))
+	api.Get("/without", newHandler("5", &buf))
+	m.Get("/root", newHandler("6", &buf))
+	api.Path("/posts").Use(newHandler("r", &buf)).Get(newHandler("7", &buf)).Post(newHandler("8", &buf))
+
+	tests := []struct {
+		method, path, chain string
+	}{
+		{GET, "/api/before", "ma1"},
+		{GET, "/api/users", "mau2"},
+		{GET, "/api/after", "max3"},
+		{GET, "/api/with", "maxw4"},
+		{GET, "/api/without", "max5"},
+		{GET, "/root", "m6"},
+		{GET, "/api/posts", "maxr7"},
+		{POST, "/api/posts", "maxr8"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.chain, buf.String(), test.method+" "+test.path)
+	}
+}
+
+func TestRouteUse(t *testing.T) {
+	var buf bytes.Buffer
+	m := New()
+	m.Use(newHandler("m", &buf))
+	m.SetParamType("num", ParamType{
+		Pattern: `[0-9]+`,
+		Convert: func(s string) (interface{}, error) {
+			buf.WriteString("c")
+			return s, nil
+		},
+	})
+	route := m.Path("/items/<n:num>")
+	assert.Equal(t, route, route.Use(newHandler("r", &buf)))
+	route.Use(newHandler("s", &buf)).Put(newHandler("2", &buf))
+	assert.Panics(t, func() { route.Use(newHandler("t", &buf)) }, "Use after Put")
+	m.Get("/items/<n:num>", newHandler("1", &buf))
+
+	for method, chain := range map[string]string{GET: "mc1", PUT: "mcrs2"} {
+		buf.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI("/items/4")
+		m.ServeHTTP(ctx)
+		assert.Equal(t, chain, buf.String(), method)
+	}
+	assert.Equal(t, 1, len(m.handlers), "len(m.handlers) =")
 }
 
 func TestRouteGroupUse(t *testing.T) {
@@ -89,3 +160,72 @@ func TestRouteGroupUse(t *testing.T) {
 	group2.Use(newHandler("3", &buf))
 	assert.Equal(t, 3, len(group2.handlers), "len(group2.handlers) =")
 }
+
+func TestRouteGroupMount(t *testing.T) {
+	type requestKey struct{}
+	var buf bytes.Buffer
+	blog := New()
+	blog.Use(newHandler("blog", &buf))
+	blog.NotFound(func(c *Context) error {
+		return c.String("blog not found", StatusNotFound)
+	})
+	blog.Get("/", func(c *Context) error {
+		return c.String("index " + string(c.Path()))
+	})
+	blog.Get("/posts/<id>", func(c *Context) error {
+		return c.String(string(c.Path()) + " " + c.URL("post", "id", 2))
+	}).Name("post")
+	blog.Get("/fail", func(c *Context) error {
+		return NewHTTPError(StatusTeapot)
+	})
+	blog.Get("/me", func(c *Context) error {
+		return c.String(fmt.Sprint(c.Get("user"), " ", c.Kontext().Value(requestKey{})))
+	})
+
+	comments := New()
+	comments.Get("/<id>", func(c *Context) error {
+		return c.String(c.Param("id").String() + " " + c.URL("comment", "id", 3))
+	}).Name("comment")
+	blog.Mount("/comments", comments)
+
+	m := New()
+	m.Use(newHandler("main", &buf))
+	m.Get("/", func(c *Context) error {
+		return c.String("main index")
+	})
+	m.Group("/sites/<site>", func(c *Context) error {
+		c.Set("user", "ann")
+		c.SetKontext(ktx.WithValue(c.Kontext(), requestKey{}, 42))
+		return nil
+	}).Mount("/blog/", blog)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+		trace  string
+	}{
+		{"/", StatusOK, "main index", "main"},
+		{"/sites/a/blog", StatusOK, "index /", "mainblog"},
+		{"/sites/a/blog/", StatusOK, "index /", "mainblog"},
+		{"/sites/a/blog/posts/1?page=2", StatusOK, "/posts/1 /sites/a/blog/posts/2", "mainblog"},
+		{"/sites/a/blog/comments/7", StatusOK, "7 /sites/a/blog/comments/3", "mainblog"},
+		{"/sites/a/blog/missing", StatusNotFound, "blog not found", "mainblog"},
+		{"/sites/a/blog/fail", StatusTeapot, "I'm a teapot", "mainblog"},
+		{"/sites/a/blog/me", StatusOK, "ann 42", "mainblog"},
+		{"/sites/a/blogger", StatusNotFound, "Not Found", "main"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(test.path)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.path)
+		assert.Equal(t, test.body, string(ctx.Response.Body()), test.path)
+		assert.Equal(t, test.trace, buf.String(), test.path)
+		assert.Equal(t, strings.SplitN(test.path, "?", 2)[0], string(ctx.Path()), "path restored")
+	}
+
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	assert.True(t, comments.ShuttingDown(), "mounted apps shut down with their parent")
+}
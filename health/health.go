@@ -0,0 +1,229 @@
+// Package health provides liveness and readiness endpoints for the macross package.
+package health
+
+import (
+	ktx "context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/insionng/macross"
+)
+
+type (
+	// Check is a named health check of a component.
+	Check struct {
+		// Name identifies the check in the report.
+		// Required.
+		Name string `json:"name"`
+
+		// Func returns an error if the component is unhealthy.
+		// It should return once its context is done.
+		// Required.
+		Func func(ktx.Context) error
+
+		// Timeout is the maximum duration of the check.
+		// Optional. Default value HealthConfig.Timeout.
+		Timeout time.Duration `json:"timeout"`
+
+		// Critical makes the probe fail when the check fails.
+		// The failure of a non-critical check is only reported with the "warn" status.
+		Critical bool `json:"critical"`
+	}
+
+	// HealthConfig defines the config for the health endpoints.
+	HealthConfig struct {
+		// LivenessPath is the path of the liveness endpoint within the route group.
+		// Optional. Default value "/livez".
+		LivenessPath string `json:"liveness_path"`
+
+		// ReadinessPath is the path of the readiness endpoint within the route group.
+		// Optional. Default value "/readyz".
+		ReadinessPath string `json:"readiness_path"`
+
+		// Timeout is the default maximum duration of a check.
+		// Optional. Default value 5 seconds.
+		Timeout time.Duration `json:"timeout"`
+	}
+
+	// Health aggregates the liveness and readiness checks of an application.
+	Health struct {
+		config    HealthConfig
+		mutex     sync.RWMutex
+		liveness  []Check
+		readiness []Check
+	}
+
+	// Report is the JSON response of the health endpoints.
+	Report struct {
+		Status string        `json:"status"` // StatusPass, StatusWarn or StatusFail
+		Reason string        `json:"reason,omitempty"`
+		Checks []CheckResult `json:"checks,omitempty"`
+	}
+
+	// CheckResult is the outcome of a check.
+	CheckResult struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Critical bool   `json:"critical"`
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
+	}
+)
+
+// Statuses
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+var (
+	// DefaultHealthConfig is the default health endpoints config.
+	DefaultHealthConfig = HealthConfig{
+		LivenessPath:  "/livez",
+		ReadinessPath: "/readyz",
+		Timeout:       5 * time.Second,
+	}
+)
+
+// New returns a Health with the default config.
+func New() *Health {
+	return NewWithConfig(DefaultHealthConfig)
+}
+
+// NewWithConfig returns a Health with config.
+// See: `New()`.
+func NewWithConfig(config HealthConfig) *Health {
+	// Defaults
+	if config.LivenessPath == "" {
+		config.LivenessPath = DefaultHealthConfig.LivenessPath
+	}
+	if config.ReadinessPath == "" {
+		config.ReadinessPath = DefaultHealthConfig.ReadinessPath
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultHealthConfig.Timeout
+	}
+	return &Health{config: config}
+}
+
+// AddLivenessCheck registers checks run by the liveness endpoint.
+// A failing critical liveness check tells the orchestrator to restart the process,
+// so these checks should not depend on external services.
+func (h *Health) AddLivenessCheck(checks ...Check) {
+	h.mutex.Lock()
+	h.liveness = append(h.liveness, checks...)
+	h.mutex.Unlock()
+}
+
+// AddReadinessCheck registers checks run by the readiness endpoint,
+// such as the availability of a database.
+func (h *Health) AddReadinessCheck(checks ...Check) {
+	h.mutex.Lock()
+	h.readiness = append(h.readiness, checks...)
+	h.mutex.Unlock()
+}
+
+// Mount registers the liveness and readiness endpoints on the route group.
+// They respond with "200 - OK" unless a critical check fails, in which case they respond
+// with "503 - Service Unavailable". The readiness endpoint also responds with
+// "503 - Service Unavailable" once the macross is shutting down, so that load balancers
+// stop sending requests to the instance. Set a shutdown delay via `Macross#SetShutdownDelay()`
+// to keep the listeners open until they have noticed.
+func (h *Health) Mount(g *macross.RouteGroup) {
+	g.Get(h.config.LivenessPath, h.Liveness)
+	g.Get(h.config.ReadinessPath, h.Readiness)
+}
+
+// Liveness is the handler of the liveness endpoint.
+func (h *Health) Liveness(c *macross.Context) error {
+	h.mutex.RLock()
+	checks := h.liveness
+	h.mutex.RUnlock()
+	return respond(c, h.run(c.Kontext(), checks))
+}
+
+// Readiness is the handler of the readiness endpoint.
+func (h *Health) Readiness(c *macross.Context) error {
+	if c.Macross().ShuttingDown() {
+		return respond(c, Report{Status: StatusFail, Reason: "shutting down"})
+	}
+	h.mutex.RLock()
+	checks := h.readiness
+	h.mutex.RUnlock()
+	return respond(c, h.run(c.Kontext(), checks))
+}
+
+func respond(c *macross.Context, report Report) error {
+	c.Response.Header.Set(macross.HeaderCacheControl, "no-cache")
+	if report.Status == StatusFail {
+		return c.JSON(report, macross.StatusServiceUnavailable)
+	}
+	return c.JSON(report, macross.StatusOK)
+}
+
+// run runs the checks concurrently and aggregates their results.
+func (h *Health) run(ctx ktx.Context, checks []Check) Report {
+	report := Report{Status: StatusPass, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Checks[i] = h.runCheck(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == StatusPass:
+		case result.Critical:
+			report.Status = StatusFail
+		case report.Status == StatusPass:
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+// runCheck runs a check until it returns or its timeout elapses.
+func (h *Health) runCheck(ctx ktx.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = h.config.Timeout
+	}
+	ctx, cancel := ktx.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := CheckResult{
+		Name:     check.Name,
+		Status:   StatusPass,
+		Critical: check.Critical,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
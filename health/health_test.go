@@ -0,0 +1,101 @@
+package health
+
+import (
+	ktx "context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insionng/macross"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func get(m *macross.Macross, path string) (int, Report) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI(path)
+	m.ServeHTTP(ctx)
+	var report Report
+	json.Unmarshal(ctx.Response.Body(), &report)
+	return ctx.Response.StatusCode(), report
+}
+
+func TestHealth(t *testing.T) {
+	var cacheFailing, dbFailing bool
+	h := New()
+	h.AddLivenessCheck(Check{Name: "goroutines", Func: func(ktx.Context) error { return nil }, Critical: true})
+	h.AddReadinessCheck(
+		Check{Name: "db", Critical: true, Func: func(ktx.Context) error {
+			if dbFailing {
+				return errors.New("connection refused")
+			}
+			return nil
+		}},
+		Check{Name: "cache", Func: func(ktx.Context) error {
+			if cacheFailing {
+				return errors.New("cache miss")
+			}
+			return nil
+		}},
+	)
+	m := macross.New()
+	h.Mount(m.Group("/health"))
+
+	status, report := get(m, "/health/livez")
+	assert.Equal(t, macross.StatusOK, status)
+	assert.Equal(t, StatusPass, report.Status)
+	assert.Equal(t, 1, len(report.Checks))
+
+	status, report = get(m, "/health/readyz")
+	assert.Equal(t, macross.StatusOK, status)
+	assert.Equal(t, StatusPass, report.Status)
+	assert.Equal(t, "db", report.Checks[0].Name)
+	assert.True(t, report.Checks[0].Critical)
+	assert.Equal(t, "cache", report.Checks[1].Name)
+
+	cacheFailing = true
+	status, report = get(m, "/health/readyz")
+	assert.Equal(t, macross.StatusOK, status, "non-critical failure")
+	assert.Equal(t, StatusWarn, report.Status)
+	assert.Equal(t, "cache miss", report.Checks[1].Error)
+
+	dbFailing = true
+	status, report = get(m, "/health/readyz")
+	assert.Equal(t, macross.StatusServiceUnavailable, status, "critical failure")
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks[0].Status)
+	assert.Equal(t, "connection refused", report.Checks[0].Error)
+
+	dbFailing, cacheFailing = false, false
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	status, report = get(m, "/health/readyz")
+	assert.Equal(t, macross.StatusServiceUnavailable, status, "shutting down")
+	assert.Equal(t, "shutting down", report.Reason)
+	status, _ = get(m, "/health/livez")
+	assert.Equal(t, macross.StatusOK, status)
+}
+
+func TestHealthTimeout(t *testing.T) {
+	h := NewWithConfig(HealthConfig{Timeout: 20 * time.Millisecond, ReadinessPath: "/ready"})
+	release := make(chan struct{})
+	defer close(release)
+	h.AddReadinessCheck(
+		Check{Name: "slow", Critical: true, Func: func(ktx.Context) error {
+			<-release
+			return nil
+		}},
+		Check{Name: "panics", Timeout: time.Second, Func: func(ktx.Context) error {
+			panic("boom")
+		}},
+	)
+	m := macross.New()
+	h.Mount(&m.RouteGroup)
+
+	start := time.Now()
+	status, report := get(m, "/ready")
+	assert.True(t, time.Since(start) < time.Second, "checks are bounded by their timeout")
+	assert.Equal(t, macross.StatusServiceUnavailable, status)
+	assert.Equal(t, "timed out after 20ms", report.Checks[0].Error)
+	assert.Equal(t, "panic: boom", report.Checks[1].Error)
+}
@@ -0,0 +1,88 @@
+package macross
+
+import (
+	"net"
+	"strings"
+)
+
+// Host returns a RouteGroup whose routes only match the requests for the given host pattern,
+// such as "api.example.com" or "<tenant>.example.com". A parameter matches a single label
+// unless it specifies its own pattern, and its value can be read via `Context#Param()`.
+// The host is matched case-insensitively and without port.
+//
+// The requests for a host matching a pattern are only routed among the routes of that host,
+// while the other requests are routed among the routes registered without host.
+// Like Group, the new group shares the handlers registered with the macross so far.
+func (r *Macross) Host(pattern string, handlers ...Handler) *RouteGroup {
+	pattern = hostPattern(pattern)
+	host := r.hosts[pattern]
+	if host == nil {
+		r.checkNotFrozen("add the host " + pattern)
+		if r.hostStore == nil {
+			r.hostStore = newStore()
+			r.hosts = make(map[string]*hostRoutes)
+		}
+		host = &hostRoutes{pattern: pattern, stores: make(map[string]routeStore)}
+		host.pcount = r.hostStore.Add(pattern, host)
+		r.hosts[pattern] = host
+		if host.pcount > r.maxParams {
+			r.maxParams = host.pcount
+		}
+		r.publishRouting()
+	}
+	group := newRouteGroup("", r, combineHandlers(r.handlers, handlers))
+	group.host = host
+	return group
+}
+
+// hostPattern normalizes a host pattern: the static parts are lower-cased, and
+// the parameters without pattern are restricted to a single label.
+func hostPattern(pattern string) string {
+	normalized := ""
+	for {
+		start := strings.IndexByte(pattern, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(pattern[start:], '>')
+		if end < 0 {
+			break
+		}
+		end += start
+		normalized += strings.ToLower(pattern[:start])
+		if token := pattern[start : end+1]; strings.IndexByte(token, ':') < 0 {
+			normalized += token[:len(token)-1] + ":[^.]+>"
+		} else {
+			normalized += token
+		}
+		pattern = pattern[end+1:]
+	}
+	normalized += strings.ToLower(pattern)
+	return strings.TrimSuffix(normalized, ".")
+}
+
+// hostname returns the lower-cased host of a Host header, without port.
+func hostname(host []byte) string {
+	h := string(host)
+	if name, _, err := net.SplitHostPort(h); err == nil {
+		h = name
+	}
+	return strings.TrimSuffix(strings.ToLower(h), ".")
+}
+
+// hostPattern returns the host pattern of the group, or "" if the group is not bound to a host.
+func (r *RouteGroup) hostPattern() string {
+	if r.host == nil {
+		return ""
+	}
+	return r.host.pattern
+}
+
+// joinNames returns the host parameter names followed by the path parameter names.
+func joinNames(hnames, pnames []string) []string {
+	if len(hnames) == 0 {
+		return pnames
+	}
+	names := make([]string, 0, len(hnames)+len(pnames))
+	return append(append(names, hnames...), pnames...)
+}
@@ -0,0 +1,83 @@
+package macross
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func serveHost(m *Macross, method, host, path string) (int, string, string) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	ctx.Request.Header.SetHost(host)
+	m.ServeHTTP(ctx)
+	return ctx.Response.StatusCode(), string(ctx.Response.Body()), string(ctx.Response.Header.Peek(HeaderAllow))
+}
+
+func TestHost(t *testing.T) {
+	m := New()
+	m.Get("/users", func(c *Context) error {
+		return c.String("main")
+	})
+	m.Host("API.example.com").Get("/users", func(c *Context) error {
+		return c.String("api")
+	})
+	tenant := m.Host("<tenant>.example.com")
+	tenant.Group("/v1").Get("/users/<id>", func(c *Context) error {
+		return c.String(c.Param("tenant").String() + " " + c.Param("id").String() + " " + c.Parameter(1))
+	})
+	m.Host("<region:(eu|us)>.<tenant>.example.com").Post("/users", func(c *Context) error {
+		return c.String(c.Param("region").String() + " " + c.Param("tenant").String())
+	})
+	m.Host("api.example.com.").Put("/users", func(c *Context) error {
+		return c.String("api put")
+	})
+	assert.Equal(t, 2, len(m.hosts["api.example.com"].stores), "the same pattern shares its routes")
+
+	tests := []struct {
+		method, host, path string
+		status             int
+		body               string
+	}{
+		{GET, "example.com", "/users", StatusOK, "main"},
+		{GET, "www.example.org:8080", "/users", StatusOK, "main"},
+		{GET, "api.example.com", "/users", StatusOK, "api"},
+		{GET, "Api.Example.com:443", "/users", StatusOK, "api"},
+		{GET, "acme.example.com", "/v1/users/42", StatusOK, "acme 42 42"},
+		{GET, "acme.example.com", "/users", StatusNotFound, ""},
+		{GET, "a.b.example.com", "/v1/users/42", StatusNotFound, ""},
+		{POST, "eu.acme.example.com", "/users", StatusOK, "eu acme"},
+		{POST, "asia.acme.example.com", "/users", StatusMethodNotAllowed, ""},
+		{PUT, "api.example.com", "/users", StatusOK, "api put"},
+	}
+	for _, test := range tests {
+		status, body, _ := serveHost(m, test.method, test.host, test.path)
+		id := test.method + " " + test.host + test.path
+		assert.Equal(t, test.status, status, id)
+		if test.status == StatusOK {
+			assert.Equal(t, test.body, body, id)
+		}
+	}
+
+	status, _, allow := serveHost(m, POST, "acme.example.com", "/v1/users/42")
+	assert.Equal(t, StatusMethodNotAllowed, status)
+	assert.Equal(t, "GET, HEAD, OPTIONS", allow)
+
+	routes := m.Routes()
+	assert.Equal(t, "", routes[0].Host)
+	assert.Equal(t, "api.example.com", routes[1].Host)
+	assert.Equal(t, "<tenant:[^.]+>.example.com", routes[2].Host)
+	assert.Equal(t, "/v1/users/<id>", routes[2].Path)
+}
+
+func TestHostPattern(t *testing.T) {
+	assert.Equal(t, "api.example.com", hostPattern("API.Example.com."))
+	assert.Equal(t, "<Tenant:[^.]+>.example.com", hostPattern("<Tenant>.EXAMPLE.com"))
+	assert.Equal(t, "<id:\\d+>.<name:[^.]+>.example.com", hostPattern("<id:\\d+>.<name>.example.com"))
+
+	assert.Equal(t, "example.com", hostname([]byte("Example.COM:8080")))
+	assert.Equal(t, "::1", hostname([]byte("[::1]:80")))
+	assert.Equal(t, "example.com", hostname([]byte("example.com.")))
+}
@@ -4,61 +4,22 @@
 package macross
 
 import (
-	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/reuseport"
-	"log"
+	"net"
 	"runtime"
-)
-
-func (m *Macross) Listen(args ...interface{}) {
-	addr := GetAddress(args...)
-	if runtime.NumCPU() > 1 {
-		runtime.GOMAXPROCS(runtime.NumCPU())
-		ln, err := reuseport.Listen("tcp4", addr)
-		if err != nil {
-			log.Fatalf("error in reuseport.Listen: %s", err)
-		}
 
-		if err = fasthttp.Serve(ln, m.ServeHTTP); err != nil {
-			log.Fatalf("error in fasthttp.Serve: %s", err)
-		}
-	} else {
-		fasthttp.ListenAndServe(addr, m.ServeHTTP)
-	}
-}
-
-func (m *Macross) ListenTLS(certFile, keyFile string, args ...interface{}) {
-	addr := GetAddress(args...)
-	if runtime.NumCPU() > 1 {
-		runtime.GOMAXPROCS(runtime.NumCPU())
-		ln, err := reuseport.Listen("tcp4", addr)
-		if err != nil {
-			log.Fatalf("error in reuseport.Listen: %s", err)
-		}
-
-		if err = fasthttp.ServeTLS(ln, certFile, keyFile, m.ServeHTTP); err != nil {
-			log.Fatalf("error in fasthttp.ServeTLS: %s", err)
-		}
-
-	} else {
-		fasthttp.ListenAndServeTLS(addr, certFile, keyFile, m.ServeHTTP)
-	}
-}
+	"github.com/valyala/fasthttp/reuseport"
+)
 
-func (m *Macross) ListenTLSEmbed(certData, keyData []byte, args ...interface{}) {
-	addr := GetAddress(args...)
+// listen opens a tcp listener for addr, using SO_REUSEPORT on multi-core machines.
+func listen(addr string) (net.Listener, error) {
+	network := listenNetwork(addr)
 	if runtime.NumCPU() > 1 {
 		runtime.GOMAXPROCS(runtime.NumCPU())
-		ln, err := reuseport.Listen("tcp4", addr)
-		if err != nil {
-			log.Fatalf("error in reuseport.Listen: %s", err)
+		if network == "tcp" {
+			// reuseport only knows tcp4 and tcp6, and a tcp6 socket is dual-stack unless IPV6_V6ONLY is set.
+			network = "tcp6"
 		}
-
-		if err = fasthttp.ServeTLSEmbed(ln, certData, keyData, m.ServeHTTP); err != nil {
-			log.Fatalf("error in fasthttp.ServeTLSEmbed: %s", err)
-		}
-
-	} else {
-		fasthttp.ListenAndServeTLSEmbed(addr, certData, keyData, m.ServeHTTP)
+		return reuseport.Listen(network, addr)
 	}
+	return net.Listen(network, addr)
 }
@@ -4,20 +4,10 @@
 package macross
 
 import (
-	"github.com/valyala/fasthttp"
+	"net"
 )
 
-func (m *Macross) Listen(args ...interface{}) {
-	addr := GetAddress(args...)
-	fasthttp.ListenAndServe(addr, m.ServeHTTP)
-}
-
-func (m *Macross) ListenTLS(certFile, keyFile string, args ...interface{}) {
-	addr := GetAddress(args...)
-	fasthttp.ListenAndServeTLS(addr, certFile, keyFile, m.ServeHTTP)
-}
-
-func (m *Macross) ListenTLSEmbed(certData, keyData []byte, args ...interface{}) {
-	addr := GetAddress(args...)
-	fasthttp.ListenAndServeTLSEmbed(addr, certData, keyData, m.ServeHTTP)
+// listen opens a tcp listener for addr.
+func listen(addr string) (net.Listener, error) {
+	return net.Listen(listenNetwork(addr), addr)
 }
@@ -4,12 +4,14 @@ package macross
 import (
 	ktx "context"
 	"io"
+	"net"
 	"os"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/valyala/fasthttp"
 	"gopkg.in/ini.v1"
@@ -25,14 +27,76 @@ type (
 		pool             sync.Pool
 		routes           map[string]*Route
 		stores           map[string]routeStore
+		hosts            map[string]*hostRoutes // the host route trees by pattern
+		hostStore        routeStore             // matches request hosts against the host patterns, nil without host routes
+		table            []routeEntry           // the registered routes, in order
+		tableIndex       map[string]int         // the table index by method, host and path pattern
+		strictRouting    bool                   // whether route conflicts panic
 		data             map[string]interface{} // data items managed by Key , Value
 		maxParams        int
+		routing          atomic.Value            // the *routing serving the requests
+		frozen           int32                   // set to 1 once the routes are frozen
+		freezeFailure    interface{}             // the panic of a failed Freeze, raised again by the next calls
+		paramTypes       map[string]ParamType    // the parameter types registered by SetParamType
+		media            map[string]*mediaRoutes // the routes declaring media types by route key
+		freezeHooks      []func()                // the functions completing the routes when they are frozen
 		binder           Binder
 		sessioner        Sessioner
 		localer          Localer
 		notFound         []Handler
 		notFoundHandlers []Handler
+		optionsHandlers  []Handler  // the handlers answering the OPTIONS requests without OPTIONS route
+		allow            routeStore // the Allow headers of the paths without host, built by Freeze
 		renderer         Renderer
+		proxies          trustedProxies
+		mutex            sync.Mutex
+		listeners        []*trackedListener // in the order they were opened
+		conns            map[*trackedConn]struct{}
+		startHooks       []func(net.Addr) error
+		shutdownHooks    []func(ktx.Context) error
+		routeHooks       []func(method, path, name string)
+		renameHooks      []func(path, previous, name string)
+		errorHooks       []func(*Context, error)
+		inShutdown       int32         // set to 1 once Shutdown has been called
+		shutdownDelay    time.Duration // how long Shutdown keeps accepting connections, see SetShutdownDelay
+		parent           *Macross      // the macross this one is mounted on, if any
+	}
+
+	// RouteInfo describes a registered route.
+	RouteInfo struct {
+		Method   string   `json:"method"`
+		Host     string   `json:"host,omitempty"` // the host pattern of routes registered via Host
+		Path     string   `json:"path"`
+		Name     string   `json:"name"`
+		Handlers []string `json:"handlers"` // the function names of the handler chain, group handlers first
+	}
+
+	// hostRoutes is the route tree of a host pattern.
+	hostRoutes struct {
+		pattern string
+		stores  map[string]routeStore
+		allow   routeStore // the Allow headers of the paths, built by Freeze
+		pcount  int        // the number of parameters in the pattern
+	}
+
+	// routing is the state used to route requests. It is replaced as a whole whenever it changes,
+	// so that requests are routed without synchronization.
+	routing struct {
+		stores    map[string]routeStore
+		hostStore routeStore
+		allow     routeStore
+		maxParams int
+		routes    map[string]*Route // the routes by name
+		table     []routeEntry      // the registered routes, in order
+	}
+
+	// routeEntry is a route registered with a method.
+	routeEntry struct {
+		method   string
+		route    *Route
+		path     string // the path pattern with the parameter types expanded
+		handlers []Handler
+		source   string // the file and line of the code registering the route
 	}
 
 	// routeStore stores route paths and the corresponding handlers.
@@ -107,9 +171,11 @@ const (
 
 // Headers
 const (
+	HeaderAccept                        = "Accept"
 	HeaderAcceptEncoding                = "Accept-Encoding"
 	HeaderAllow                         = "Allow"
 	HeaderAuthorization                 = "Authorization"
+	HeaderCacheControl                  = "Cache-Control"
 	HeaderContentDisposition            = "Content-Disposition"
 	HeaderContentEncoding               = "Content-Encoding"
 	HeaderContentLength                 = "Content-Length"
@@ -122,9 +188,13 @@ const (
 	HeaderUpgrade                       = "Upgrade"
 	HeaderVary                          = "Vary"
 	HeaderWWWAuthenticate               = "WWW-Authenticate"
+	HeaderDeprecation                   = "Deprecation"
+	HeaderSunset                        = "Sunset"
+	HeaderForwarded                     = "Forwarded"
 	HeaderXForwardedProto               = "X-Forwarded-Proto"
 	HeaderXHTTPMethodOverride           = "X-HTTP-Method-Override"
 	HeaderXForwardedFor                 = "X-Forwarded-For"
+	HeaderXForwardedHost                = "X-Forwarded-Host"
 	HeaderXRealIP                       = "X-Real-IP"
 	HeaderServer                        = "Server"
 	HeaderOrigin                        = "Origin"
@@ -300,7 +370,7 @@ func New() *Macross {
 	m.pool.New = func() interface{} {
 		return &Context{
 			ktx:     ktx.Background(),
-			pvalues: make([]string, m.maxParams),
+			pvalues: make([]string, m.currentRouting().maxParams),
 			macross: m,
 		}
 	}
@@ -323,7 +393,7 @@ func Classic() *Macross {
 			ktx:     ktx.Background(),
 			Session: m.sessioner,
 			Localer: m.localer,
-			pvalues: make([]string, m.maxParams),
+			pvalues: make([]string, m.currentRouting().maxParams),
 			macross: m,
 		}
 	}
@@ -344,29 +414,109 @@ func (m *Macross) AcquireContext() *Context {
 // ReleaseContext returns the `Context` instance back to the pool.
 // You must call it after `AcquireContext()`.
 func (m *Macross) ReleaseContext(c *Context) {
-	c.Response.Header.SetServer("Macross")
 	m.pool.Put(c)
 }
 
 // ServeHTTP handles the HTTP request.
 func (m *Macross) ServeHTTP(ctx *fasthttp.RequestCtx) {
+	if m.ShuttingDown() {
+		ctx.SetConnectionClose()
+	}
+
+	m.handle(ctx, "", nil)
+}
+
+// handle dispatches the request to the handlers of the matching route.
+// The prefix is the path the macross is mounted at, if any, and parent is the context
+// of the request in the macross it is mounted on, whose data the context carries.
+func (m *Macross) handle(ctx *fasthttp.RequestCtx, prefix string, parent *Context) {
+	if atomic.LoadInt32(&m.frozen) == 0 {
+		m.Freeze()
+	}
 	c := m.AcquireContext()
 	c.Reset(ctx)
-	c.handlers, c.pnames = m.find(string(ctx.Method()), string(ctx.Path()), c.pvalues)
+	c.prefix = prefix
+	if parent != nil {
+		c.data, c.ktx, c.Session, c.Localer, c.Flash = parent.data, parent.ktx, parent.Session, parent.Localer, parent.Flash
+	}
+	c.path = append(c.path[:0], ctx.Path()...)
+	rt := m.currentRouting()
+	if len(c.pvalues) < rt.maxParams {
+		// the routes were replaced by routes with more parameters since the context was created
+		c.pvalues = make([]string, rt.maxParams)
+	}
+	head := false
+	if c.handlers, c.pnames = rt.find(ctx.Host(), ctx.Method(), b2s(c.path), c.pvalues); c.handlers == nil {
+		switch string(ctx.Method()) {
+		case HEAD:
+			// the GET route serves the request, without the body of the response
+			c.handlers, c.pnames = rt.find(ctx.Host(), getMethod, b2s(c.path), c.pvalues)
+			head = c.handlers != nil
+		case OPTIONS:
+			if rt.allowed(ctx.Host(), b2s(c.path)) != "" {
+				c.handlers = m.optionsHandlers
+			}
+		}
+		if c.handlers == nil {
+			c.handlers = m.notFoundHandlers
+		}
+	}
 	if err := c.Next(); err != nil {
+		for _, hook := range m.errorHooks {
+			hook(c, err)
+		}
 		m.HandleError(c, err)
 	}
+	if head {
+		dropBody(&ctx.Response)
+	}
 	m.ReleaseContext(c)
 }
 
 // Route returns the named route.
 // Nil is returned if the named route cannot be found.
 func (r *Macross) Route(name string) *Route {
-	return r.routes[name]
+	return r.currentRouting().routes[name]
+}
+
+// Routes returns the registered routes in the order they were added.
+// A route registered again with the same method and path is ignored: the route registered first
+// is the one listed and served.
+func (r *Macross) Routes() []RouteInfo {
+	table := r.currentRouting().table
+	routes := make([]RouteInfo, len(table))
+	for i, entry := range table {
+		handlers := make([]string, len(entry.handlers))
+		for j, h := range entry.handlers {
+			handlers[j] = HandlerName(h)
+		}
+		routes[i] = RouteInfo{
+			Method:   entry.method,
+			Host:     entry.route.group.hostPattern(),
+			Path:     entry.route.path,
+			Name:     entry.route.name,
+			Handlers: handlers,
+		}
+	}
+	return routes
+}
+
+// String returns a one-line description of the route for startup logs and debugging,
+// e.g. "GET /users/<id> (user) main.auth, main.showUser".
+func (ri RouteInfo) String() string {
+	s := ri.Method + " " + ri.Host + ri.Path
+	if ri.Name != ri.Path {
+		s += " (" + ri.Name + ")"
+	}
+	if len(ri.Handlers) > 0 {
+		s += " " + strings.Join(ri.Handlers, ", ")
+	}
+	return s
 }
 
 // Use appends the specified handlers to the macross and shares them with all routes.
 func (r *Macross) Use(handlers ...Handler) {
+	r.checkNotFrozen("add middleware")
 	r.RouteGroup.Use(handlers...)
 	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
 }
@@ -374,10 +524,31 @@ func (r *Macross) Use(handlers ...Handler) {
 // NotFound specifies the handlers that should be invoked when the macross cannot find any route matching a request.
 // Note that the handlers registered via Use will be invoked first in this case.
 func (r *Macross) NotFound(handlers ...Handler) {
+	r.checkNotFrozen("set the not found handlers")
 	r.notFound = handlers
 	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
 }
 
+// OnRouteAdded registers functions that are called whenever a method of a route is added,
+// with the route path pattern and the route name, which defaults to the path.
+// Naming a route after adding its methods calls the OnRouteRenamed hooks instead.
+func (r *Macross) OnRouteAdded(hooks ...func(method, path, name string)) {
+	r.routeHooks = append(r.routeHooks, hooks...)
+}
+
+// OnRouteRenamed registers functions that are called whenever a route whose methods were added
+// is named, with the route path pattern, the previous name of the route and its new name.
+func (r *Macross) OnRouteRenamed(hooks ...func(path, previous, name string)) {
+	r.renameHooks = append(r.renameHooks, hooks...)
+}
+
+// OnError registers functions that are called with the errors returned by the handlers,
+// before they are handled by HandleError.
+// They must be registered before the macross starts serving requests.
+func (r *Macross) OnError(hooks ...func(c *Context, err error)) {
+	r.errorHooks = append(r.errorHooks, hooks...)
+}
+
 // HandleError is the error handler for handling any unhandled errors.
 func (m *Macross) HandleError(c *Context, err interface{}) {
 	status := StatusInternalServerError
@@ -396,37 +567,167 @@ func (m *Macross) HandleError(c *Context, err interface{}) {
 	}
 }
 
-func (r *Macross) add(method, path string, handlers []Handler) {
-	store := r.stores[method]
+// add adds the handlers of a route to the route tree of the host, or to the main route tree if host is nil.
+func (r *Macross) add(host *hostRoutes, method, path string, handlers []Handler) {
+	stores, offset := r.stores, 0
+	if host != nil {
+		stores, offset = host.stores, host.pcount
+	}
+	store := stores[method]
 	if store == nil {
 		store = newStore()
-		r.stores[method] = store
+		stores[method] = store
 	}
-	if n := store.Add(path, handlers); n > r.maxParams {
+	if n := offset + store.Add(path, handlers); n > r.maxParams {
 		r.maxParams = n
 	}
 }
 
-func (r *Macross) find(method, path string, pvalues []string) (handlers []Handler, pnames []string) {
+// Freeze validates and compiles the routes, which can no longer be changed afterwards:
+// registering or changing a route then panics, and the routes can only be replaced as a whole with SwapRoutes.
+// It panics if a route has no handlers, and the next calls panic again with the same value.
+// The Listen methods and Serve freeze the macross before serving, which allows to catch invalid
+// routes at startup. A macross served through ServeHTTP only, such as one passed to a server
+// built with NewServer, is frozen when it handles its first request if Freeze has not been called before.
+//
+// Compiling the routes builds the Allow header of each route path. The requests with a method
+// that has no route are then handled as follows: HEAD is served by the GET route, if any, with
+// the body of the response dropped and its Content-Length kept, and OPTIONS responds with
+// the Allow header, after the handlers registered via Use.
+func (m *Macross) Freeze() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.frozen == 1 {
+		return
+	}
+	if m.freezeFailure != nil {
+		panic(m.freezeFailure)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			m.freezeFailure = r
+			panic(r)
+		}
+	}()
+	for _, hook := range m.freezeHooks {
+		hook()
+	}
+	for _, entry := range m.table {
+		if len(entry.handlers) == 0 {
+			panic("macross: route " + entry.String() + " has no handlers")
+		}
+	}
+	m.compileAllow()
+	m.optionsHandlers = combineHandlers(m.handlers, []Handler{MethodNotAllowedHandler})
+	m.publishRouting()
+	atomic.StoreInt32(&m.frozen, 1)
+}
+
+// checkNotFrozen panics if the macross is frozen, as changing its routes would race with the requests.
+func (r *Macross) checkNotFrozen(action string) {
+	if atomic.LoadInt32(&r.frozen) == 1 {
+		panic("macross: cannot " + action + " once the macross is frozen (" + callerSource() + "): use SwapRoutes to replace the routes of a serving macross")
+	}
+}
+
+// SwapRoutes replaces the routes of the macross with the routes registered on next, a macross created
+// with New() to build them off to the side, for example from a configuration that changes at runtime.
+// The routes are replaced atomically: the requests being handled finish on the old routes.
+// The new routes are served with the handlers they were registered with, including the middleware of next,
+// while the not found handlers and the other settings of the macross are kept.
+// Next is frozen, and the macross stays frozen if it was.
+func (m *Macross) SwapRoutes(next *Macross) {
+	next.Freeze()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.routes, m.table, m.tableIndex = next.routes, next.table, next.tableIndex
+	m.stores, m.hosts, m.hostStore, m.allow = next.stores, next.hosts, next.hostStore, next.allow
+	m.maxParams, m.media = next.maxParams, next.media
+	// the freeze hooks of the macross completed the routes being replaced, and those of next have run
+	m.freezeHooks = nil
+	m.publishRouting()
+}
+
+// publishRouting makes the routes registered so far serve the requests.
+func (r *Macross) publishRouting() {
+	r.routing.Store(r.newRouting())
+}
+
+// currentRouting returns the routing serving the requests.
+func (r *Macross) currentRouting() *routing {
+	if rt, okay := r.routing.Load().(*routing); okay {
+		return rt
+	}
+	return r.newRouting()
+}
+
+// newRouting returns the routing of the routes registered so far.
+func (r *Macross) newRouting() *routing {
+	return &routing{
+		stores:    r.stores,
+		hostStore: r.hostStore,
+		allow:     r.allow,
+		maxParams: r.maxParams,
+		routes:    r.routes,
+		table:     r.table,
+	}
+}
+
+// register records the route in the route table.
+// Like the route stores, the table keeps the first of duplicate routes.
+func (r *Macross) register(method string, route *Route, path string, handlers []Handler, source string) {
+	if r.tableIndex == nil {
+		r.tableIndex = make(map[string]int)
+	}
+	key := routeKey(route.group.host, method, path)
+	if _, exists := r.tableIndex[key]; exists {
+		return
+	}
+	r.tableIndex[key] = len(r.table)
+	r.table = append(r.table, routeEntry{method: method, route: route, path: path, handlers: handlers, source: source})
+}
+
+// routeAdded calls the OnRouteAdded hooks.
+func (r *Macross) routeAdded(method, path, name string) {
+	for _, hook := range r.routeHooks {
+		hook(method, path, name)
+	}
+}
+
+// routeRenamed calls the OnRouteRenamed hooks.
+func (r *Macross) routeRenamed(path, previous, name string) {
+	for _, hook := range r.renameHooks {
+		hook(path, previous, name)
+	}
+}
+
+// find returns the handlers of the route matching the request, or nil if there is none,
+// and the names of its parameters, whose values are stored in pvalues.
+// It makes no allocations unless there are host routes.
+func (r *routing) find(host, method []byte, path string, pvalues []string) (handlers []Handler, pnames []string) {
+	stores, hnames := r.storesFor(host, pvalues)
 	var hh interface{}
-	if store := r.stores[method]; store != nil {
-		hh, pnames = store.Get(path, pvalues)
+	if store := stores[string(method)]; store != nil {
+		hh, pnames = store.Get(path, pvalues[len(hnames):])
 	}
+	pnames = joinNames(hnames, pnames)
 	if hh != nil {
 		return hh.([]Handler), pnames
 	}
-	return r.notFoundHandlers, pnames
+	return nil, pnames
 }
 
-func (r *Macross) findAllowedMethods(path string) map[string]bool {
-	methods := make(map[string]bool)
-	pvalues := make([]string, r.maxParams)
-	for m, store := range r.stores {
-		if handlers, _ := store.Get(path, pvalues); handlers != nil {
-			methods[m] = true
-		}
+// storesFor returns the route stores serving the requests for host.
+// The values of the host parameters are stored at the beginning of pvalues.
+func (r *routing) storesFor(host []byte, pvalues []string) (map[string]routeStore, []string) {
+	if r.hostStore == nil {
+		return r.stores, nil
 	}
-	return methods
+	data, hnames := r.hostStore.Get(hostname(host), pvalues)
+	if data == nil {
+		return r.stores, nil
+	}
+	return data.(*hostRoutes).stores, hnames
 }
 
 func (m *Macross) Pull(key string) interface{} {
@@ -505,28 +806,25 @@ func NotFoundHandler(*Context) error {
 }
 
 // MethodNotAllowedHandler handles the situation when a request has matching route without matching HTTP method.
-// In this case, the handler will respond with an Allow HTTP header listing the allowed HTTP methods.
+// In this case, the handler will respond with an Allow HTTP header listing the allowed HTTP methods,
+// as built when the routes are frozen.
 // Otherwise, the handler will do nothing and let the next handler (usually a NotFoundHandler) to handle the problem.
 func MethodNotAllowedHandler(c *Context) error {
-	methods := c.Macross().findAllowedMethods(string(c.Path()))
-	if len(methods) == 0 {
+	allow := c.macross.currentRouting().allowed(c.RequestCtx.Host(), b2s(c.path))
+	if allow == "" {
 		return nil
 	}
-	methods["OPTIONS"] = true
-	ms := make([]string, len(methods))
-	i := 0
-	for method := range methods {
-		ms[i] = method
-		i++
-	}
-	sort.Strings(ms)
-	c.Response.Header.Set("Allow", strings.Join(ms, ", "))
+	c.Response.Header.Set(HeaderAllow, allow)
 	if string(c.Method()) != "OPTIONS" {
 		c.Response.SetStatusCode(StatusMethodNotAllowed)
 	}
 	return c.Abort()
 }
 
+// GetAddress builds the listening address from the given arguments, which may be
+// a "host:port" string, a port number, or a host string followed by a port number.
+// The HOST and PORT environment variables take precedence over the arguments.
+// IPv6 hosts may be given in brackets, e.g. "[::1]:9000".
 func GetAddress(args ...interface{}) string {
 
 	var host string
@@ -535,20 +833,19 @@ func GetAddress(args ...interface{}) string {
 	if len(args) == 1 {
 		switch arg := args[0].(type) {
 		case string:
-			addrs := strings.Split(args[0].(string), ":")
-			if len(addrs) == 1 {
-				host = addrs[0]
-			} else if len(addrs) >= 2 {
-				host = addrs[0]
-				_port, _ := strconv.ParseInt(addrs[1], 10, 0)
+			if h, p, err := net.SplitHostPort(arg); err == nil {
+				host = h
+				_port, _ := strconv.ParseInt(p, 10, 0)
 				port = int(_port)
+			} else {
+				host = strings.Trim(arg, "[]")
 			}
 		case int:
 			port = arg
 		}
 	} else if len(args) >= 2 {
 		if arg, ok := args[0].(string); ok {
-			host = arg
+			host = strings.Trim(arg, "[]")
 		}
 		if arg, ok := args[1].(int); ok {
 			port = arg
@@ -567,7 +864,7 @@ func GetAddress(args ...interface{}) string {
 		port = 8000
 	}
 
-	addr := host + ":" + strconv.FormatInt(int64(port), 10)
+	addr := net.JoinHostPort(host, strconv.FormatInt(int64(port), 10))
 	return addr
 
 }
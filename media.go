@@ -0,0 +1,209 @@
+package macross
+
+import (
+	"strings"
+)
+
+type (
+	// mediaRoutes are the routes of a method and a path pattern that declare the media types
+	// they consume or produce, in the order they were registered. A request is served by the one
+	// consuming its content type and producing the type it accepts most.
+	mediaRoutes struct {
+		routes        []*mediaRoute
+		vary          bool      // whether a route produces declared media types, so that the responses vary by Accept
+		unsupported   []Handler // the handler chain of the requests no route consumes the body of
+		notAcceptable []Handler // the handler chain of the requests accepting no type produced by the routes
+	}
+
+	// mediaRoute is a route declaring media types.
+	mediaRoute struct {
+		consumes []string
+		produces []string
+		handlers []Handler // the handler chain of the route, made of the handlers of its route group and its own
+		pnames   []string  // the names of the host and path parameters of the route
+	}
+)
+
+// Consumes sets the media types of the request bodies accepted by the methods of the route,
+// such as "application/json" or "image/*". A request with a body of another type responds with
+// "415 - Unsupported Media Type" before the handlers of the route run. A body without Content-Type
+// is taken as "application/octet-stream", and a request without body is accepted.
+// It panics if a method was already added to the route. See `Produces()` for the routes
+// differing by their media types only.
+func (r *Route) Consumes(mimes ...string) *Route {
+	r.group.macross.checkNotFrozen("call Consumes on route " + r.group.hostPattern() + r.path)
+	r.checkNoMethods("Consumes")
+	r.consumes = mediaTypes(mimes)
+	return r
+}
+
+// Produces sets the media types of the responses of the methods of the route, in the order
+// of preference of the server. The type accepted most by the request, according to its Accept
+// header, can be read via `Context#ResponseType()`, and a request accepting none of them
+// responds with "406 - Not Acceptable" after the handlers of the route group.
+// It panics if a method was already added to the route.
+//
+// Routes with the same method and path pattern that declare different media types don't conflict:
+// a request is served by the first one consuming its content type and producing the type it accepts most,
+// with the handlers of its own route group.
+//
+//	m.Path("/users").Produces(macross.MIMEApplicationJSON).Get(listUsersJSON)
+//	m.With(export).Path("/users").Produces("text/csv").Get(listUsersCSV)
+func (r *Route) Produces(mimes ...string) *Route {
+	r.group.macross.checkNotFrozen("call Produces on route " + r.group.hostPattern() + r.path)
+	r.checkNoMethods("Produces")
+	r.produces = mediaTypes(mimes)
+	return r
+}
+
+// ResponseType returns the media type of the response negotiated among those produced by the route,
+// or an empty string if the route declares none. See `Route#Produces()`.
+func (c *Context) ResponseType() string {
+	return c.produced
+}
+
+// mediaRoutes returns the routes declaring media types with the same method and path pattern as a route,
+// and whether there were none so far.
+func (m *Macross) mediaRoutes(route *Route, method, path string) (*mediaRoutes, bool) {
+	key := routeKey(route.group.host, method, path)
+	if rs, exists := m.media[key]; exists {
+		return rs, false
+	}
+	if m.media == nil {
+		m.media = make(map[string]*mediaRoutes)
+	}
+	rs := &mediaRoutes{}
+	m.media[key] = rs
+	return rs, true
+}
+
+// add adds a route declaring media types with the given handlers, preceded by those of its route group,
+// and returns the handler chain serving the requests of all the routes, which negotiates the media types.
+// The path is the path pattern of the route with the parameter types expanded.
+func (rs *mediaRoutes) add(route *Route, path string, handlers []Handler) []Handler {
+	mr := &mediaRoute{
+		consumes: route.consumes,
+		produces: route.produces,
+		handlers: combineHandlers(route.group.handlers, handlers),
+		pnames:   joinNames(paramNames(route.group.hostPattern()), paramNames(path)),
+	}
+	if len(rs.routes) == 0 {
+		// the requests no route serves respond with an error after the handlers of the route group of the first one
+		rs.unsupported = combineHandlers(route.group.handlers, []Handler{func(*Context) error {
+			return ErrUnsupportedMediaType
+		}})
+		rs.notAcceptable = combineHandlers(route.group.handlers, []Handler{func(*Context) error {
+			return ErrNotAcceptable
+		}})
+	}
+	rs.routes = append(rs.routes, mr)
+	rs.vary = rs.vary || len(mr.produces) > 0
+	return []Handler{rs.negotiate}
+}
+
+// negotiate selects the route serving the request, and continues with its handler chain and parameter names.
+func (rs *mediaRoutes) negotiate(c *Context) error {
+	ctype := ""
+	if len(c.Request.Body()) > 0 {
+		ctype = requestType(string(c.Request.Header.ContentType()))
+	}
+	accept := string(c.Request.Header.Peek(HeaderAccept))
+
+	var best *mediaRoute
+	bestType, bestQ, consumed := "", 0.0, false
+	for _, mr := range rs.routes {
+		if !mr.accepts(ctype) {
+			continue
+		}
+		consumed = true
+		if t, q := mr.produce(accept); q > bestQ {
+			best, bestType, bestQ = mr, t, q
+		}
+	}
+	if rs.vary {
+		c.Response.Header.Add(HeaderVary, HeaderAccept)
+	}
+
+	c.index = -1
+	switch {
+	case best != nil:
+		c.produced = bestType
+		c.handlers, c.pnames = best.handlers, best.pnames
+	case consumed:
+		c.handlers = rs.notAcceptable
+	default:
+		c.handlers = rs.unsupported
+	}
+	return nil
+}
+
+// accepts returns whether the route consumes a request body of the given media type,
+// which is empty for a request without body.
+func (mr *mediaRoute) accepts(ctype string) bool {
+	if len(mr.consumes) == 0 || ctype == "" {
+		return true
+	}
+	for _, mime := range mr.consumes {
+		if mime == ctype || mime == "*/*" || strings.HasSuffix(mime, "/*") && strings.HasPrefix(ctype, mime[:len(mime)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// produce returns the media type the route produces for the Accept header, and its quality value.
+// A route producing no declared media type accepts any request.
+func (mr *mediaRoute) produce(accept string) (string, float64) {
+	if len(mr.produces) == 0 {
+		return "", 1
+	}
+	if accept == "" {
+		return mr.produces[0], 1
+	}
+	best, bestQ := "", 0.0
+	for _, mime := range mr.produces {
+		if q := acceptQuality(accept, mime); q > bestQ {
+			best, bestQ = mime, q
+		}
+	}
+	return best, bestQ
+}
+
+// paramNames returns the names of the parameters of a path or host pattern.
+func paramNames(pattern string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(pattern, '<')
+		end := strings.IndexByte(pattern, '>')
+		if start < 0 || end < start {
+			return names
+		}
+		name := pattern[start+1 : end]
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name = name[:i]
+		}
+		names = append(names, name)
+		pattern = pattern[end+1:]
+	}
+}
+
+// requestType returns the media type of a Content-Type header, without its parameters.
+func requestType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if contentType == "" {
+		return MIMEOctetStream
+	}
+	return contentType
+}
+
+// mediaTypes normalizes the media types declared by a route.
+func mediaTypes(mimes []string) []string {
+	types := make([]string, len(mimes))
+	for i, mime := range mimes {
+		types[i] = strings.ToLower(strings.TrimSpace(mime))
+	}
+	return types
+}
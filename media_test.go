@@ -0,0 +1,140 @@
+package macross
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func serveMedia(m *Macross, method, path, ctype, accept, body string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	if ctype != "" {
+		ctx.Request.Header.SetContentType(ctype)
+	}
+	if accept != "" {
+		ctx.Request.Header.Set(HeaderAccept, accept)
+	}
+	ctx.Request.SetBodyString(body)
+	m.ServeHTTP(ctx)
+	return ctx
+}
+
+func TestRouteConsumesProduces(t *testing.T) {
+	var buf bytes.Buffer
+	m := New()
+	m.Use(newHandler("m", &buf))
+	m.Path("/users").Consumes(MIMEApplicationJSON, "text/*").Produces(MIMEApplicationJSON, MIMEApplicationXML).Post(func(c *Context) error {
+		return c.String(c.ResponseType())
+	})
+	m.Post("/plain", func(c *Context) error {
+		return c.String("[" + c.ResponseType() + "]")
+	})
+
+	tests := []struct {
+		id, path, ctype, accept, body string
+		status                        int
+		response                      string
+	}{
+		{"json", "/users", "application/json; charset=UTF-8", "", "{}", StatusOK, MIMEApplicationJSON},
+		{"text", "/users", "text/plain", "application/xml", "a", StatusOK, MIMEApplicationXML},
+		{"quality", "/users", "", "application/json;q=0.5, application/*", "", StatusOK, MIMEApplicationXML},
+		{"no body", "/users", "", "*/*", "", StatusOK, MIMEApplicationJSON},
+		{"unsupported", "/users", "application/xml", "", "<a/>", StatusUnsupportedMediaType, ""},
+		{"no content type", "/users", "", "", "a", StatusUnsupportedMediaType, ""},
+		{"not acceptable", "/users", MIMEApplicationJSON, "text/html", "{}", StatusNotAcceptable, ""},
+		{"undeclared", "/plain", "image/png", "text/html", "a", StatusOK, "[]"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ctx := serveMedia(m, POST, test.path, test.ctype, test.accept, test.body)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.id)
+		assert.Equal(t, "m", buf.String(), test.id)
+		if test.status == StatusOK {
+			assert.Equal(t, test.response, string(ctx.Response.Body()), test.id)
+		}
+		if test.path == "/users" {
+			assert.Equal(t, HeaderAccept, string(ctx.Response.Header.Peek(HeaderVary)), test.id)
+		}
+	}
+}
+
+func TestRouteMediaAlternatives(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	m := New()
+	m.Use(newHandler("m", &buf))
+	m.Path("/report").Produces(MIMEApplicationJSON).Use(newHandler("r", &buf)).Get(newHandler("json", &buf))
+	m.With(newHandler("w", &buf)).Path("/report").Produces("text/csv", "text/plain").Get(newHandler("csv", &buf))
+	m.Path("/report/<id:int>").Consumes(MIMEApplicationJSON).Put(newHandler("json", &buf))
+	m.Path("/report/<n:int>").Consumes("image/*").Put(func(c *Context) error {
+		buf.WriteString("image" + c.Param("n").String())
+		return nil
+	})
+	tenant := m.Host("<tenant>.example.com")
+	tenant.Path("/users/<id>").Produces(MIMEApplicationJSON).Get(newHandler("json", &buf))
+	tenant.Path("/users/<name>").Produces(MIMETextPlain).Get(func(c *Context) error {
+		return c.String(c.Param("tenant").String() + "/" + c.Param("name").String())
+	})
+	assert.Equal(t, "", buf.String(), "conflicts")
+
+	tests := []struct {
+		id, method, path, ctype, accept string
+		status                          int
+		chain                           string
+	}{
+		{"first", GET, "/report", "", "", StatusOK, "mrjson"},
+		{"second", GET, "/report", "", "text/plain", StatusOK, "mwcsv"},
+		{"preferred", GET, "/report", "", "text/*, application/json;q=0.9", StatusOK, "mwcsv"},
+		{"tie", GET, "/report", "", "*/*", StatusOK, "mrjson"},
+		{"none", GET, "/report", "", "image/png", StatusNotAcceptable, "m"},
+		{"consumes first", PUT, "/report/1", MIMEApplicationJSON, "", StatusOK, "mjson"},
+		{"consumes second", PUT, "/report/2", "image/png", "", StatusOK, "mimage2"},
+		{"consumes none", PUT, "/report/3", "text/plain", "", StatusUnsupportedMediaType, "m"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ctx := serveMedia(m, test.method, test.path, test.ctype, test.accept, map[bool]string{true: "data"}[test.method == PUT])
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.id)
+		assert.Equal(t, test.chain, buf.String(), test.id)
+	}
+	var routes []string
+	for _, route := range m.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+	assert.Equal(t, []string{
+		"GET /report",
+		"GET /report",
+		"PUT /report/<id:int>",
+		"PUT /report/<n:int>",
+		"GET /users/<id>",
+		"GET /users/<name>",
+	}, routes)
+	assert.Panics(t, func() { m.Get("/export", newHandler("e", &buf)).Produces("text/csv") }, "Produces after Get")
+	assert.Panics(t, func() { m.Path("/import").Put(newHandler("i", &buf)).Consumes("text/csv") }, "Consumes after Put")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/ann")
+	ctx.Request.Header.SetHost("acme.example.com")
+	ctx.Request.Header.Set(HeaderAccept, MIMETextPlain)
+	m.ServeHTTP(ctx)
+	assert.Equal(t, "acme/ann", string(ctx.Response.Body()))
+}
+
+func TestTypedProduces(t *testing.T) {
+	m := New()
+	m.Path("/users").Produces(MIMEApplicationXML).Post(Typed(func(c *Context, req *typedUserRequest) (*typedUser, error) {
+		return &typedUser{ID: 1, Name: req.Name}, nil
+	}))
+	ctx := serveMedia(m, POST, "/users", MIMEApplicationJSON, "", `{"name":"ann"}`)
+	assert.Equal(t, StatusOK, ctx.Response.StatusCode())
+	assert.Contains(t, string(ctx.Response.Body()), "<name>ann</name>")
+	assert.Equal(t, HeaderAccept, string(ctx.Response.Header.Peek(HeaderVary)))
+}
@@ -0,0 +1,196 @@
+// Package mtls provides a client certificate authentication middleware for the macross package.
+package mtls
+
+import (
+	"crypto/x509"
+	"path"
+
+	"github.com/insionng/macross"
+	"github.com/insionng/macross/skipper"
+)
+
+type (
+	// MTLSConfig defines the config for MTLS middleware.
+	MTLSConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper skipper.Skipper
+
+		// ClientCAs is the pool the client certificate chain is verified against.
+		// Optional. If nil, the chains verified during the TLS handshake are used,
+		// which requires tls.Config.ClientAuth to be VerifyClientCertIfGiven or
+		// RequireAndVerifyClientCert.
+		ClientCAs *x509.CertPool
+
+		// CommonNames lists the accepted subject common names.
+		// Optional. Any common name is accepted if empty.
+		CommonNames []string `json:"common_names"`
+
+		// Organizations lists the accepted subject organizations.
+		// Optional. Any organization is accepted if empty.
+		Organizations []string `json:"organizations"`
+
+		// DNSNames, EmailAddresses and URIs list the accepted subject alternative names.
+		// A certificate is accepted if any of its SANs matches. Optional. Any SAN is
+		// accepted if all of them are empty.
+		DNSNames       []string `json:"dns_names"`
+		EmailAddresses []string `json:"email_addresses"`
+		URIs           []string `json:"uris"`
+
+		// Context key to store the client identity into context.
+		// Optional. Default value "mtls".
+		ContextKey string `json:"context_key"`
+	}
+
+	// Identity is the client identity parsed from a verified certificate.
+	Identity struct {
+		CommonName          string
+		Organizations       []string
+		OrganizationalUnits []string
+		DNSNames            []string
+		EmailAddresses      []string
+		URIs                []string
+		SerialNumber        string
+		Certificate         *x509.Certificate   // the client certificate
+		Chain               []*x509.Certificate // the verified chain, from the client certificate to the root
+	}
+)
+
+var (
+	// DefaultMTLSConfig is the default MTLS middleware config.
+	DefaultMTLSConfig = MTLSConfig{
+		Skipper:    skipper.DefaultSkipper,
+		ContextKey: "mtls",
+	}
+)
+
+// MTLS returns a middleware that authenticates clients by their TLS certificate
+// verified against the given CA pool.
+//
+// For a valid certificate, it sets the client `Identity` in context and calls next handler.
+// For a missing or unverified certificate, it returns "401 - Unauthorized" error.
+// For a certificate not matching the subject rules, it returns "403 - Forbidden" error.
+func MTLS(clientCAs *x509.CertPool) macross.Handler {
+	c := DefaultMTLSConfig
+	c.ClientCAs = clientCAs
+	return MTLSWithConfig(c)
+}
+
+// MTLSWithConfig returns a MTLS middleware with config.
+// The subject rules may contain shell patterns as understood by path.Match,
+// e.g. "*.internal.example.com".
+// See: `MTLS()`.
+func MTLSWithConfig(config MTLSConfig) macross.Handler {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultMTLSConfig.Skipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = DefaultMTLSConfig.ContextKey
+	}
+
+	return func(c *macross.Context) error {
+		if config.Skipper(c) {
+			return c.Next()
+		}
+
+		certs := c.PeerCertificates()
+		if len(certs) == 0 {
+			return c.Break(macross.StatusUnauthorized, macross.NewHTTPError(macross.StatusUnauthorized, "client certificate required"))
+		}
+
+		chains := c.VerifiedChains()
+		if config.ClientCAs != nil {
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			var err error
+			chains, err = certs[0].Verify(x509.VerifyOptions{
+				Roots:         config.ClientCAs,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			if err != nil {
+				return c.Break(macross.StatusUnauthorized, macross.ErrUnauthorized)
+			}
+		}
+		if len(chains) == 0 {
+			return c.Break(macross.StatusUnauthorized, macross.ErrUnauthorized)
+		}
+
+		if !config.allows(certs[0]) {
+			return c.Break(macross.StatusForbidden, macross.NewHTTPError(macross.StatusForbidden))
+		}
+
+		// Store the client identity into context.
+		c.Set(config.ContextKey, newIdentity(chains[0]))
+		return c.Next()
+	}
+}
+
+// GetIdentity returns the client identity stored by the MTLS middleware,
+// or nil if there is none.
+func GetIdentity(self *macross.Context, contextKey ...string) *Identity {
+	var key string
+	if len(contextKey) == 0 {
+		key = DefaultMTLSConfig.ContextKey
+	} else {
+		key = contextKey[0]
+	}
+
+	if id, okay := self.Get(key).(*Identity); okay {
+		return id
+	}
+	return nil
+}
+
+// allows reports whether the certificate satisfies the subject rules of the config.
+func (config *MTLSConfig) allows(cert *x509.Certificate) bool {
+	if len(config.CommonNames) > 0 && !matchAny(config.CommonNames, []string{cert.Subject.CommonName}) {
+		return false
+	}
+	if len(config.Organizations) > 0 && !matchAny(config.Organizations, cert.Subject.Organization) {
+		return false
+	}
+	if len(config.DNSNames)+len(config.EmailAddresses)+len(config.URIs) > 0 {
+		return matchAny(config.DNSNames, cert.DNSNames) ||
+			matchAny(config.EmailAddresses, cert.EmailAddresses) ||
+			matchAny(config.URIs, uriStrings(cert))
+	}
+	return true
+}
+
+// matchAny reports whether any of the values matches any of the patterns.
+func matchAny(patterns, values []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func uriStrings(cert *x509.Certificate) []string {
+	uris := make([]string, len(cert.URIs))
+	for i, uri := range cert.URIs {
+		uris[i] = uri.String()
+	}
+	return uris
+}
+
+func newIdentity(chain []*x509.Certificate) *Identity {
+	cert := chain[0]
+	return &Identity{
+		CommonName:          cert.Subject.CommonName,
+		Organizations:       cert.Subject.Organization,
+		OrganizationalUnits: cert.Subject.OrganizationalUnit,
+		DNSNames:            cert.DNSNames,
+		EmailAddresses:      cert.EmailAddresses,
+		URIs:                uriStrings(cert),
+		SerialNumber:        cert.SerialNumber.String(),
+		Certificate:         cert,
+		Chain:               chain,
+	}
+}
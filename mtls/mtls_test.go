@@ -0,0 +1,158 @@
+package mtls
+
+import (
+	"bufio"
+	ktx "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/insionng/macross"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// newTestCertificate creates a certificate from template, signed by parent or self-signed if parent is nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func newTestCA(t *testing.T, name string) tls.Certificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+}
+
+func newTestClient(t *testing.T, ca *tls.Certificate, subject pkix.Name, dnsNames []string, uris ...string) tls.Certificate {
+	template := &x509.Certificate{
+		Subject:     subject,
+		DNSNames:    dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		u, _ := url.Parse(uri)
+		template.URIs = append(template.URIs, u)
+	}
+	return newTestCertificate(t, template, ca)
+}
+
+func TestMTLS(t *testing.T) {
+	ca, other := newTestCA(t, "ca"), newTestCA(t, "other")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, nil)
+
+	m := macross.New()
+	handler := func(c *macross.Context) error {
+		id := GetIdentity(c)
+		return c.String(id.CommonName + "/" + id.SerialNumber)
+	}
+	m.Get("/", MTLS(pool), handler)
+	m.Get("/rules", MTLSWithConfig(MTLSConfig{
+		ClientCAs:     pool,
+		Organizations: []string{"acme"},
+		DNSNames:      []string{"*.svc.example.com"},
+		URIs:          []string{"spiffe://example.com/*"},
+	}), handler)
+	m.Get("/key", MTLSWithConfig(MTLSConfig{ClientCAs: pool, ContextKey: "client"}), func(c *macross.Context) error {
+		return c.String(GetIdentity(c, "client").CommonName)
+	})
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.ServeWithConfig(macross.ServerConfig{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequestClientCert,
+	}}, ln)
+	defer m.Shutdown(ktx.Background())
+
+	get := func(path string, certs ...tls.Certificate) (int, string) {
+		conn, err := tls.Dial("tcp4", ln.Addr().String(), &tls.Config{Certificates: certs, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		var res fasthttp.Response
+		if err := res.Read(bufio.NewReader(conn)); err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode(), string(res.Body())
+	}
+
+	alice := newTestClient(t, &ca, pkix.Name{CommonName: "alice", Organization: []string{"acme"}}, []string{"alice.svc.example.com"})
+	bob := newTestClient(t, &ca, pkix.Name{CommonName: "bob", Organization: []string{"acme"}}, nil, "spiffe://example.com/bob")
+	carol := newTestClient(t, &ca, pkix.Name{CommonName: "carol", Organization: []string{"other"}}, []string{"carol.svc.example.com"})
+	dave := newTestClient(t, &ca, pkix.Name{CommonName: "dave", Organization: []string{"acme"}}, []string{"dave.example.com"})
+	mallory := newTestClient(t, &other, pkix.Name{CommonName: "mallory", Organization: []string{"acme"}}, []string{"mallory.svc.example.com"})
+
+	tests := []struct {
+		path   string
+		certs  []tls.Certificate
+		status int
+		body   string
+	}{
+		{"/", nil, macross.StatusUnauthorized, ""},
+		{"/", []tls.Certificate{mallory}, macross.StatusUnauthorized, ""},
+		{"/", []tls.Certificate{alice}, macross.StatusOK, "alice/" + alice.Leaf.SerialNumber.String()},
+		{"/rules", []tls.Certificate{alice}, macross.StatusOK, "alice/" + alice.Leaf.SerialNumber.String()},
+		{"/rules", []tls.Certificate{bob}, macross.StatusOK, "bob/" + bob.Leaf.SerialNumber.String()},
+		{"/rules", []tls.Certificate{carol}, macross.StatusForbidden, ""},
+		{"/rules", []tls.Certificate{dave}, macross.StatusForbidden, ""},
+		{"/key", []tls.Certificate{dave}, macross.StatusOK, "dave"},
+	}
+	for _, test := range tests {
+		status, body := get(test.path, test.certs...)
+		assert.Equal(t, test.status, status, test.path)
+		if test.body != "" {
+			assert.Equal(t, test.body, body, test.path)
+		}
+	}
+}
+
+func TestMTLSPlainConnection(t *testing.T) {
+	m := macross.New()
+	m.Get("/", MTLS(x509.NewCertPool()), func(c *macross.Context) error {
+		return c.String("ok")
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/")
+	m.ServeHTTP(ctx)
+	assert.Equal(t, macross.StatusUnauthorized, ctx.Response.StatusCode())
+}
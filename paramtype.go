@@ -0,0 +1,115 @@
+package macross
+
+import (
+	"strconv"
+	"time"
+)
+
+type (
+	// ParamType is a named type of route parameters, such as "int" in "/users/<id:int>".
+	ParamType struct {
+		// Pattern is the regular expression matching the parameter values.
+		// Required.
+		Pattern string
+
+		// Convert converts a matching value into the value returned by `Args#Value()`.
+		// A request whose value it fails to convert responds with "404 - Not Found".
+		// Optional. The value is kept as a string by default.
+		Convert func(string) (interface{}, error)
+	}
+)
+
+var (
+	// paramTypes are the built-in parameter types.
+	paramTypes = map[string]ParamType{
+		"int": {
+			Pattern: `-?[0-9]+`,
+			Convert: func(s string) (interface{}, error) {
+				return strconv.Atoi(s)
+			},
+		},
+		"slug": {
+			Pattern: `[a-z0-9]+(?:-[a-z0-9]+)*`,
+		},
+		"uuid": {
+			Pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+		},
+		"date": {
+			Pattern: `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+			Convert: func(s string) (interface{}, error) {
+				return time.Parse("2006-01-02", s)
+			},
+		},
+	}
+)
+
+// SetParamType registers a named parameter type, which can then be used in route paths
+// in place of a regular expression, like "<id:int>". The built-in types are "int", "slug",
+// "uuid" and "date", and registering a type of the same name replaces them.
+// Types must be registered before the routes using them.
+func (m *Macross) SetParamType(name string, t ParamType) {
+	m.checkNotFrozen("set param type " + name)
+	if m.paramTypes == nil {
+		m.paramTypes = make(map[string]ParamType)
+	}
+	m.paramTypes[name] = t
+}
+
+// paramType returns the parameter type of the given name.
+func (m *Macross) paramType(name string) (ParamType, bool) {
+	if t, okay := m.paramTypes[name]; okay {
+		return t, true
+	}
+	t, okay := paramTypes[name]
+	return t, okay
+}
+
+// expandParamTypes replaces the named types in the param tokens of path with their patterns.
+// It also returns the types by parameter name, or nil if there are none.
+func (m *Macross) expandParamTypes(path string) (string, map[string]ParamType) {
+	var types map[string]ParamType
+	expanded, last, start, colon := "", 0, -1, -1
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '<' && start < 0:
+			start, colon = i, -1
+		case path[i] == ':' && start >= 0 && colon < 0:
+			colon = i
+		case path[i] == '>' && start >= 0:
+			if colon >= 0 {
+				if t, okay := m.paramType(path[colon+1 : i]); okay {
+					if types == nil {
+						types = make(map[string]ParamType)
+					}
+					types[path[start+1:colon]] = t
+					expanded += path[last:colon+1] + t.Pattern
+					last = i
+				}
+			}
+			start = -1
+		}
+	}
+	return expanded + path[last:], types
+}
+
+// convertParams returns a handler converting the values of the typed parameters of a route.
+// It responds with "404 - Not Found" if a value cannot be converted.
+func convertParams(types map[string]ParamType) Handler {
+	return func(c *Context) error {
+		for i, name := range c.pnames {
+			t, okay := types[name]
+			if !okay || t.Convert == nil {
+				continue
+			}
+			v, err := t.Convert(c.Parameter(i))
+			if err != nil {
+				return ErrNotFound
+			}
+			if c.params == nil {
+				c.params = make(map[string]interface{}, len(types))
+			}
+			c.params[name] = v
+		}
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package macross
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParamTypes(t *testing.T) {
+	m := New()
+	m.SetParamType("lang", ParamType{
+		Pattern: `[a-z]{2}`,
+		Convert: func(s string) (interface{}, error) {
+			if s == "xx" {
+				return nil, errors.New("unknown language")
+			}
+			return strings.ToUpper(s), nil
+		},
+	})
+	value := func(name string) Handler {
+		return func(c *Context) error {
+			v := c.Param(name).Value()
+			return c.String(fmt.Sprintf("%T %v", v, v))
+		}
+	}
+	m.Get("/users/<id:int>", value("id"))
+	m.Get("/users/<name>", value("name"))
+	m.Get("/posts/<slug:slug>", value("slug"))
+	m.Get("/orders/<u:uuid>", value("u"))
+	m.Get("/archive/<d:date>", func(c *Context) error {
+		return c.String(c.Param("d").Value().(time.Time).Format("Jan 2, 2006"))
+	})
+	m.Get("/<lang:lang>/about", value("lang"))
+	m.Get("/files/<n:\\d+>", value("n"))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/users/42", StatusOK, "int 42"},
+		{"/users/-1", StatusOK, "int -1"},
+		{"/users/ann", StatusOK, "string ann"},
+		{"/users/99999999999999999999", StatusNotFound, ""},
+		{"/posts/hello-world-2", StatusOK, "string hello-world-2"},
+		{"/posts/Hello", StatusNotFound, ""},
+		{"/orders/0b6f5d2e-6a7c-4b1e-9d3f-8c2a1e4f7b90", StatusOK, "string 0b6f5d2e-6a7c-4b1e-9d3f-8c2a1e4f7b90"},
+		{"/orders/42", StatusNotFound, ""},
+		{"/archive/2016-02-29", StatusOK, "Feb 29, 2016"},
+		{"/archive/2017-02-29", StatusNotFound, ""},
+		{"/en/about", StatusOK, "string EN"},
+		{"/xx/about", StatusNotFound, ""},
+		{"/files/7", StatusOK, "string 7"},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(test.path)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.path)
+		if test.status == StatusOK {
+			assert.Equal(t, test.body, string(ctx.Response.Body()), test.path)
+		}
+	}
+
+	assert.Equal(t, "/users/<id:int>", m.Routes()[0].Path)
+	assert.Equal(t, "/users/5", m.Route("/users/<id:int>").URL("id", 5))
+}
+
+func TestExpandParamTypes(t *testing.T) {
+	m := New()
+	path, types := m.expandParamTypes("/users/<id:int>/<:.*>")
+	assert.Equal(t, "/users/<id:-?[0-9]+>/<:.*>", path)
+	assert.Equal(t, 1, len(types))
+	assert.NotNil(t, types["id"].Convert)
+
+	path, types = m.expandParamTypes("/<a:slug>/<b>/<c:\\d{2}>-<d:date>")
+	assert.Equal(t, "/<a:[a-z0-9]+(?:-[a-z0-9]+)*>/<b>/<c:\\d{2}>-<d:[0-9]{4}-[0-9]{2}-[0-9]{2}>", path)
+	assert.Equal(t, 2, len(types))
+
+	path, types = m.expandParamTypes("/users/<id>")
+	assert.Equal(t, "/users/<id>", path)
+	assert.Nil(t, types)
+}
@@ -0,0 +1,337 @@
+package macross
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// ProxyProtocolConfig defines the config for a PROXY protocol listener.
+	ProxyProtocolConfig struct {
+		// TrustedCIDRs lists the networks of the load balancers allowed to send PROXY headers,
+		// e.g. "10.0.0.0/8" or a single address. Connections from other sources are served
+		// with their own address, and a PROXY header sent by them is treated as request data.
+		// Connections on unix sockets are always trusted.
+		// Required.
+		TrustedCIDRs []string `json:"trusted_cidrs"`
+
+		// HeaderTimeout is the maximum duration for reading the PROXY header of a trusted connection.
+		// Optional. Default value 5 seconds.
+		HeaderTimeout time.Duration `json:"header_timeout"`
+	}
+
+	// proxyListener wraps a net.Listener so that the connections from trusted
+	// sources report the addresses read from their PROXY protocol header.
+	proxyListener struct {
+		net.Listener
+		trusted []*net.IPNet
+		timeout time.Duration
+		start   sync.Once
+		conns   chan net.Conn // the accepted connections whose header has been read
+		failed  chan struct{} // closed once accepting from the wrapped listener fails
+		err     error         // the error of the wrapped listener, set before failed is closed
+	}
+
+	// proxyConn is a connection from a trusted source whose PROXY protocol header has been read.
+	proxyConn struct {
+		net.Conn
+		reader *bufio.Reader
+		remote net.Addr // the client address from the header, if any
+		local  net.Addr // the destination address from the header, if any
+	}
+)
+
+var (
+	// DefaultProxyProtocolConfig is the default PROXY protocol listener config.
+	DefaultProxyProtocolConfig = ProxyProtocolConfig{
+		HeaderTimeout: 5 * time.Second,
+	}
+)
+
+// PROXY protocol constants
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyV2Signature = "\r\n\r\n\x00\r\nQUIT\n"
+	proxyV2Length    = 16  // signature, version and command, family, address length
+	proxyUnixLength  = 108 // the size of a unix socket address
+	proxyBufferSize  = 256 // large enough for a v1 line and the v2 addresses
+)
+
+// NewProxyListener wraps ln so that connections from the trusted sources of config
+// report the client address sent in a PROXY protocol v1 or v2 header, as HAProxy and
+// AWS NLB do, through RemoteAddr, and thus through Context.RemoteAddress and Context.RealIP.
+// A trusted connection without header is served with its own address.
+//
+// The header of each trusted connection is read in its own goroutine before Accept returns
+// the connection, so that a slow client does not hold up the other connections.
+func NewProxyListener(ln net.Listener, config ProxyProtocolConfig) (net.Listener, error) {
+	// Defaults
+	if config.HeaderTimeout == 0 {
+		config.HeaderTimeout = DefaultProxyProtocolConfig.HeaderTimeout
+	}
+	if len(config.TrustedCIDRs) == 0 {
+		return nil, errors.New("no trusted source for the PROXY protocol")
+	}
+
+	trusted, err := parseCIDRs(config.TrustedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyListener{
+		Listener: ln,
+		trusted:  trusted,
+		timeout:  config.HeaderTimeout,
+		conns:    make(chan net.Conn),
+		failed:   make(chan struct{}),
+	}, nil
+}
+
+// Accept waits for the next connection, whose header has been read if it comes from a trusted source.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	l.start.Do(func() {
+		go l.accept()
+	})
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.failed:
+		return nil, l.err
+	}
+}
+
+// accept accepts the connections of the wrapped listener until it fails, and reads
+// the header of those from trusted sources in their own goroutine.
+func (l *proxyListener) accept() {
+	var delay time.Duration
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if ne, okay := err.(net.Error); okay && ne.Temporary() {
+				// back off like net/http, e.g. when running out of file descriptors
+				if delay = 2 * delay; delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			l.err = err
+			close(l.failed)
+			return
+		}
+		delay = 0
+		if !l.trusts(c.RemoteAddr()) {
+			l.deliver(c)
+			continue
+		}
+		go func() {
+			pc := &proxyConn{Conn: c, reader: bufio.NewReaderSize(c, proxyBufferSize)}
+			c.SetReadDeadline(time.Now().Add(l.timeout))
+			err := pc.parseHeader()
+			c.SetReadDeadline(time.Time{})
+			if err != nil {
+				c.Close()
+				return
+			}
+			l.deliver(pc)
+		}()
+	}
+}
+
+// deliver hands a connection over to Accept, or closes it if the listener has failed.
+func (l *proxyListener) deliver(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.failed:
+		c.Close()
+	}
+}
+
+func (l *proxyListener) trusts(addr net.Addr) bool {
+	tcp, okay := addr.(*net.TCPAddr)
+	if !okay {
+		return true
+	}
+	return containsIP(l.trusted, tcp.IP)
+}
+
+// Read reads data following the PROXY header.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address sent in the PROXY header,
+// or the address of the peer if there was none.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address sent in the PROXY header,
+// or the local address if there was none.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// parseHeader consumes the PROXY header if the connection starts with one.
+func (c *proxyConn) parseHeader() error {
+	b, err := c.reader.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch b[0] {
+	case proxyV1Prefix[0]:
+		if b, err = c.reader.Peek(len(proxyV1Prefix)); err == nil && string(b) == proxyV1Prefix {
+			return c.parseV1()
+		}
+	case proxyV2Signature[0]:
+		if b, err = c.reader.Peek(len(proxyV2Signature)); err == nil && string(b) == proxyV2Signature {
+			return c.parseV2()
+		}
+	}
+	return nil
+}
+
+// parseV1 parses a human-readable header such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func (c *proxyConn) parseV1() error {
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil || len(line) > proxyV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return ErrInvalidProxyHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return ErrInvalidProxyHeader
+	}
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil || (src.To4() != nil) != (fields[1] == "TCP4") {
+		return ErrInvalidProxyHeader
+	}
+	c.remote = &net.TCPAddr{IP: src, Port: int(srcPort)}
+	c.local = &net.TCPAddr{IP: dst, Port: int(dstPort)}
+	return nil
+}
+
+// parseV2 parses a binary header.
+func (c *proxyConn) parseV2() error {
+	header, err := c.reader.Peek(proxyV2Length)
+	if err != nil {
+		return ErrInvalidProxyHeader
+	}
+	command, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if command>>4 != 2 || command&0xF > 1 {
+		return ErrInvalidProxyHeader
+	}
+
+	var addrLength int
+	switch family >> 4 {
+	case 1: // IPv4
+		addrLength = 2*net.IPv4len + 4
+	case 2: // IPv6
+		addrLength = 2*net.IPv6len + 4
+	case 3: // unix
+		addrLength = 2 * proxyUnixLength
+	}
+	if length < addrLength {
+		return ErrInvalidProxyHeader
+	}
+	header, err = c.reader.Peek(proxyV2Length + addrLength)
+	if err != nil {
+		return ErrInvalidProxyHeader
+	}
+
+	var remote, local net.Addr
+	addrs := header[proxyV2Length:]
+	if command&0xF == 1 { // PROXY, while LOCAL connections are health checks of the proxy itself
+		switch family {
+		case 0x11, 0x21: // TCP over IPv4 or IPv6
+			n := addrLength/2 - 2
+			remote = &net.TCPAddr{IP: net.IP(copyBytes(addrs[:n])), Port: int(binary.BigEndian.Uint16(addrs[2*n:]))}
+			local = &net.TCPAddr{IP: net.IP(copyBytes(addrs[n : 2*n])), Port: int(binary.BigEndian.Uint16(addrs[2*n+2:]))}
+		case 0x12, 0x22: // UDP over IPv4 or IPv6
+			n := addrLength/2 - 2
+			remote = &net.UDPAddr{IP: net.IP(copyBytes(addrs[:n])), Port: int(binary.BigEndian.Uint16(addrs[2*n:]))}
+			local = &net.UDPAddr{IP: net.IP(copyBytes(addrs[n : 2*n])), Port: int(binary.BigEndian.Uint16(addrs[2*n+2:]))}
+		case 0x31, 0x32: // unix stream or datagram
+			network := "unix"
+			if family == 0x32 {
+				network = "unixgram"
+			}
+			remote = &net.UnixAddr{Name: unixName(addrs[:proxyUnixLength]), Net: network}
+			local = &net.UnixAddr{Name: unixName(addrs[proxyUnixLength:]), Net: network}
+		}
+	}
+
+	// skip the addresses and the TLVs
+	if _, err = c.reader.Discard(proxyV2Length + length); err != nil {
+		return ErrInvalidProxyHeader
+	}
+	c.remote, c.local = remote, local
+	return nil
+}
+
+// parseCIDRs parses a list of CIDR networks or single IP addresses.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP reports whether ip belongs to any of the networks.
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
+
+// unixName returns the null-terminated socket path of a PROXY header address.
+func unixName(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
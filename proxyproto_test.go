@@ -0,0 +1,149 @@
+package macross
+
+import (
+	"bufio"
+	ktx "context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// proxyV2Header builds a binary PROXY header for TCP over IPv4.
+func proxyV2Header(command byte, src, dst string, srcPort, dstPort uint16, tlvs []byte) []byte {
+	b := []byte(proxyV2Signature)
+	b = append(b, 0x20|command, 0x11, 0, 0)
+	b = append(b, net.ParseIP(src).To4()...)
+	b = append(b, net.ParseIP(dst).To4()...)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-4:], srcPort)
+	binary.BigEndian.PutUint16(b[len(b)-2:], dstPort)
+	b = append(b, tlvs...)
+	binary.BigEndian.PutUint16(b[14:16], uint16(len(b)-proxyV2Length))
+	return b
+}
+
+func TestProxyListener(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RemoteAddress() + " " + c.RealIP() + " " + c.LocalAddr().String())
+	})
+	url, _ := startTestServer(t, m, ServerConfig{ProxyProtocol: &ProxyProtocolConfig{TrustedCIDRs: []string{"127.0.0.0/8"}}})
+	defer m.Shutdown(ktx.Background())
+	addr := url[len("http://"):]
+
+	tests := []struct {
+		id     string
+		header string
+		body   string // empty if the connection is expected to be closed
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324 192.0.2.1 198.51.100.1:443"},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324 2001:db8::1 [2001:db8::2]:443"},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", ""},
+		{"v2 proxy", string(proxyV2Header(1, "192.0.2.1", "198.51.100.1", 56324, 443, nil)), "192.0.2.1:56324 192.0.2.1 198.51.100.1:443"},
+		{"v2 tlvs", string(proxyV2Header(1, "192.0.2.1", "198.51.100.1", 56324, 443, []byte{0x04, 0, 1, 0})), "192.0.2.1:56324 192.0.2.1 198.51.100.1:443"},
+		{"v2 local", string(proxyV2Header(0, "192.0.2.1", "198.51.100.1", 56324, 443, nil)), ""},
+		{"no header", "", ""},
+		{"v1 malformed", "PROXY TCP4 192.0.2.1\r\n", "closed"},
+		{"v1 mismatched family", "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n", "closed"},
+		{"v2 bad version", "\r\n\r\n\x00\r\nQUIT\n\x11\x11\x00\x00", "closed"},
+	}
+	for _, test := range tests {
+		conn, err := net.Dial("tcp4", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(test.header + "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		var res fasthttp.Response
+		err = res.Read(bufio.NewReader(conn))
+		switch test.body {
+		case "closed":
+			assert.NotNil(t, err, test.id)
+		case "":
+			// served with the address of the peer
+			assert.Nil(t, err, test.id)
+			assert.Contains(t, string(res.Body()), "127.0.0.1 127.0.0.1", test.id)
+		default:
+			assert.Nil(t, err, test.id)
+			assert.Equal(t, test.body, string(res.Body()), test.id)
+		}
+		conn.Close()
+	}
+}
+
+func TestProxyListenerSlowClient(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RealIP())
+	})
+	config := ServerConfig{MaxConnsPerIP: 10, ProxyProtocol: &ProxyProtocolConfig{TrustedCIDRs: []string{"127.0.0.0/8"}, HeaderTimeout: time.Minute}}
+	url, _ := startTestServer(t, m, config)
+	defer m.Shutdown(ktx.Background())
+	addr := url[len("http://"):]
+
+	// a trusted client that does not send its header holds up neither Accept nor the other clients
+	slow, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	conn, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	var res fasthttp.Response
+	assert.Nil(t, res.Read(bufio.NewReader(conn)))
+	assert.Equal(t, "192.0.2.1", string(res.Body()))
+}
+
+func TestProxyListenerUntrusted(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String(c.RealIP())
+	})
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := NewProxyListener(ln, ProxyProtocolConfig{TrustedCIDRs: []string{"10.0.0.0/8", "192.0.2.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Serve(pl)
+	defer m.Shutdown(ktx.Background())
+
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	var res fasthttp.Response
+	assert.Nil(t, res.Read(bufio.NewReader(conn)))
+	assert.NotEqual(t, "192.0.2.1", string(res.Body()), "the header of an untrusted source is ignored")
+
+	_, err = NewProxyListener(ln, ProxyProtocolConfig{})
+	assert.NotNil(t, err)
+	_, err = NewProxyListener(ln, ProxyProtocolConfig{TrustedCIDRs: []string{"10.0.0.0/33"}})
+	assert.NotNil(t, err)
+}
+
+func TestParseCIDRs(t *testing.T) {
+	networks, err := parseCIDRs([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::1"})
+	assert.Nil(t, err)
+	assert.True(t, containsIP(networks, net.ParseIP("10.1.2.3")))
+	assert.True(t, containsIP(networks, net.ParseIP("192.0.2.1")))
+	assert.False(t, containsIP(networks, net.ParseIP("192.0.2.2")))
+	assert.True(t, containsIP(networks, net.ParseIP("2001:db8::5")))
+	assert.True(t, containsIP(networks, net.ParseIP("::1")))
+	assert.False(t, containsIP(networks, net.ParseIP("::2")))
+
+	_, err = parseCIDRs([]string{"localhost"})
+	assert.NotNil(t, err)
+}
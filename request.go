@@ -2,9 +2,12 @@ package macross
 
 import (
 	"bytes"
+	"crypto/x509"
 	"io"
 	"mime/multipart"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/valyala/fasthttp"
 )
@@ -14,13 +17,44 @@ func (c *Context) IsTLS() bool {
 	return c.RequestCtx.IsTLS()
 }
 
+// PeerCertificates returns the certificate chain presented by the client over TLS,
+// leaf first. It returns nil for plain connections or if no certificate was sent.
+func (c *Context) PeerCertificates() []*x509.Certificate {
+	if state := c.RequestCtx.TLSConnectionState(); state != nil {
+		return state.PeerCertificates
+	}
+	return nil
+}
+
+// VerifiedChains returns the client certificate chains verified during the TLS handshake.
+// It is only populated if the server requires or verifies client certificates.
+func (c *Context) VerifiedChains() [][]*x509.Certificate {
+	if state := c.RequestCtx.TLSConnectionState(); state != nil {
+		return state.VerifiedChains
+	}
+	return nil
+}
+
 // Scheme implements `Context#Scheme` function.
+// Behind a trusted proxy, it returns the scheme reported by the Forwarded or X-Forwarded-Proto header.
+// See `Macross#SetTrustedProxies()`.
 func (c *Context) Scheme() string {
+	if hop, okay := c.forwarded(); okay && hop.proto != "" {
+		return hop.proto
+	}
+	if c.IsTLS() {
+		return "https"
+	}
 	return string(c.RequestCtx.URI().Scheme())
 }
 
 // Host implements `Context#Host` function.
+// Behind a trusted proxy, it returns the host reported by the Forwarded or X-Forwarded-Host header.
+// See `Macross#SetTrustedProxies()`.
 func (c *Context) Host() string {
+	if hop, okay := c.forwarded(); okay && hop.host != "" {
+		return hop.host
+	}
 	return string(c.RequestCtx.Host())
 }
 
@@ -50,15 +84,14 @@ func (c *Context) RemoteAddress() string {
 }
 
 // RealIP implements `Context#RealIP` function.
+// Behind a trusted proxy, it returns the client address reported by the Forwarded, X-Forwarded-For
+// or X-Real-IP header, read from right to left. Otherwise it returns the address of the peer.
+// See `Macross#SetTrustedProxies()`.
 func (c *Context) RealIP() string {
-	ra := c.RemoteAddress()
-	if ip := c.Request.Header.Peek(HeaderXForwardedFor); ip != nil {
-		ra = string(ip)
-	} else if ip := c.Request.Header.Peek(HeaderXRealIP); ip != nil {
-		ra = string(ip)
-	} else {
-		ra, _, _ = net.SplitHostPort(ra)
+	if hop, okay := c.forwarded(); okay && hop.addr != "" {
+		return hop.addr
 	}
+	ra, _, _ := net.SplitHostPort(c.RemoteAddress())
 	return ra
 }
 
@@ -82,6 +115,59 @@ func (c *Context) SetURI(uri string) {
 	c.Request.Header.SetRequestURI(uri)
 }
 
+// Negotiate returns the offered content type the client prefers according to the Accept header.
+// Offers are listed in the order of preference of the server, which breaks ties between them.
+// It returns the first offer if the request has no Accept header, and an empty string
+// if the client accepts none of the offers.
+func (c *Context) Negotiate(offers ...string) string {
+	accept := string(c.Request.Header.Peek(HeaderAccept))
+	if accept == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality value of the most specific media range of the Accept
+// header that matches the content type, or 0 if none matches.
+func acceptQuality(accept, ctype string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mrange := strings.ToLower(strings.TrimSpace(params[0]))
+		s := -1
+		switch {
+		case mrange == ctype:
+			s = 2
+		case mrange == "*/*":
+			s = 0
+		case strings.HasSuffix(mrange, "/*") && strings.HasPrefix(ctype, mrange[:len(mrange)-1]):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return q
+}
+
 // Body implements `Context#Body` function.
 func (c *Context) Body() io.Reader {
 	return bytes.NewBuffer(c.Request.Body())
@@ -0,0 +1,87 @@
+package macross
+
+import (
+	"strings"
+)
+
+// Resource registers the RESTful routes of a resource for the methods implemented by the controller,
+// each of which has the signature `func(*Context) error`:
+//
+//	GET    /users            Index    users.index
+//	GET    /users/new        New      users.new
+//	POST   /users            Create   users.create
+//	GET    /users/<id>       Show     users.show
+//	GET    /users/<id>/edit  Edit     users.edit
+//	PUT    /users/<id>       Update   users.update
+//	PATCH  /users/<id>       Patch    users.patch
+//	DELETE /users/<id>       Destroy  users.destroy
+//
+// The given handlers run before those of the controller.
+// Resource returns the group of a resource member, in which nested resources can be registered:
+// its prefix is `/users/<user_id>`, where the parameter is named after the singular of the resource
+// name, and the nested route names start with "users.", e.g. "users.posts.show".
+func (r *RouteGroup) Resource(name string, controller interface{}, handlers ...Handler) *RouteGroup {
+	collection := newRouteGroup(r.prefix+"/"+name, r.macross, combineHandlers(r.handlers, handlers))
+	collection.host = r.host
+	name = r.name + name
+
+	if c, okay := controller.(interface {
+		Index(*Context) error
+	}); okay {
+		collection.Get("", c.Index).Name(name + ".index")
+	}
+	// registered before the member routes so that "new" is not taken for an id
+	if c, okay := controller.(interface {
+		New(*Context) error
+	}); okay {
+		collection.Get("/new", c.New).Name(name + ".new")
+	}
+	if c, okay := controller.(interface {
+		Create(*Context) error
+	}); okay {
+		collection.Post("", c.Create).Name(name + ".create")
+	}
+	if c, okay := controller.(interface {
+		Show(*Context) error
+	}); okay {
+		collection.Get("/<id>", c.Show).Name(name + ".show")
+	}
+	if c, okay := controller.(interface {
+		Edit(*Context) error
+	}); okay {
+		collection.Get("/<id>/edit", c.Edit).Name(name + ".edit")
+	}
+	if c, okay := controller.(interface {
+		Update(*Context) error
+	}); okay {
+		collection.Put("/<id>", c.Update).Name(name + ".update")
+	}
+	if c, okay := controller.(interface {
+		Patch(*Context) error
+	}); okay {
+		collection.Patch("/<id>", c.Patch).Name(name + ".patch")
+	}
+	if c, okay := controller.(interface {
+		Destroy(*Context) error
+	}); okay {
+		collection.Delete("/<id>", c.Destroy).Name(name + ".destroy")
+	}
+
+	member := collection.Group("/<" + singular(name[strings.LastIndexByte(name, '.')+1:]) + "_id>")
+	member.name = name + "."
+	return member
+}
+
+// singular returns the singular of an English plural noun for the common cases,
+// e.g. "users" -> "user", "categories" -> "category", "boxes" -> "box".
+func singular(noun string) string {
+	switch {
+	case strings.HasSuffix(noun, "ies") && len(noun) > 3:
+		return noun[:len(noun)-3] + "y"
+	case strings.HasSuffix(noun, "sses"), strings.HasSuffix(noun, "xes"), strings.HasSuffix(noun, "ches"), strings.HasSuffix(noun, "shes"):
+		return noun[:len(noun)-2]
+	case strings.HasSuffix(noun, "s") && !strings.HasSuffix(noun, "ss"):
+		return noun[:len(noun)-1]
+	}
+	return noun
+}
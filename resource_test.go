@@ -0,0 +1,107 @@
+package macross
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type usersController struct{}
+
+func (usersController) Index(c *Context) error {
+	return c.String("users.index")
+}
+
+func (usersController) New(c *Context) error {
+	return c.String("users.new")
+}
+
+func (usersController) Create(c *Context) error {
+	return c.String("users.create")
+}
+
+func (usersController) Show(c *Context) error {
+	return c.String("users.show " + c.Param("id").String())
+}
+
+func (usersController) Edit(c *Context) error {
+	return c.String("users.edit " + c.Param("id").String())
+}
+
+func (usersController) Update(c *Context) error {
+	return c.String("users.update " + c.Param("id").String())
+}
+
+func (usersController) Patch(c *Context) error {
+	return c.String("users.patch " + c.Param("id").String())
+}
+
+func (usersController) Destroy(c *Context) error {
+	return c.String("users.destroy " + c.Param("id").String())
+}
+
+type postsController struct{}
+
+func (*postsController) Index(c *Context) error {
+	return c.String("posts.index " + c.Param("user_id").String() + " " + c.URL("users.posts.show", "user_id", 1, "id", 2))
+}
+
+func (*postsController) Show(c *Context) error {
+	return c.String("posts.show " + c.Param("user_id").String() + " " + c.Param("id").String())
+}
+
+func TestRouteGroupResource(t *testing.T) {
+	m := New()
+	api := m.Group("/api")
+	users := api.Resource("users", usersController{})
+	users.Resource("posts", &postsController{})
+	m.Resource("categories", struct{}{})
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{GET, "/api/users", StatusOK, "users.index"},
+		{GET, "/api/users/new", StatusOK, "users.new"},
+		{POST, "/api/users", StatusOK, "users.create"},
+		{GET, "/api/users/1", StatusOK, "users.show 1"},
+		{GET, "/api/users/1/edit", StatusOK, "users.edit 1"},
+		{PUT, "/api/users/1", StatusOK, "users.update 1"},
+		{PATCH, "/api/users/1", StatusOK, "users.patch 1"},
+		{DELETE, "/api/users/1", StatusOK, "users.destroy 1"},
+		{GET, "/api/users/1/posts", StatusOK, "posts.index 1 /api/users/1/posts/2"},
+		{GET, "/api/users/1/posts/2", StatusOK, "posts.show 1 2"},
+		{POST, "/api/users/1/posts", StatusMethodNotAllowed, ""},
+		{GET, "/categories", StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.method+" "+test.path)
+		if test.status == StatusOK {
+			assert.Equal(t, test.body, string(ctx.Response.Body()), test.method+" "+test.path)
+		}
+	}
+
+	assert.Equal(t, "/api/users/5/edit", m.Route("users.edit").URL("id", 5))
+	assert.Equal(t, "/api/users/<user_id>/posts/<id>", m.Route("users.posts.show").path)
+	assert.Nil(t, m.Route("users.posts.create"))
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"users":      "user",
+		"categories": "category",
+		"boxes":      "box",
+		"classes":    "class",
+		"branches":   "branch",
+		"data":       "data",
+	}
+	for plural, expected := range tests {
+		assert.Equal(t, expected, singular(plural), plural)
+	}
+}
@@ -0,0 +1,148 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd rumprun
+
+package macross
+
+import (
+	ktx "context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Restart starts a new instance of the running binary with the same arguments and
+// passes it the listeners being served, in the order they were opened.
+// The new process picks them up with InheritedListeners and serves them through Serve,
+// so that no connection is refused while the binary is replaced.
+// Restart returns once the new process serves one of the listeners, or an error if it exits before.
+// It does not stop the current process: call Shutdown afterwards to drain it.
+func (m *Macross) Restart() (*os.Process, error) {
+	return m.restart(ktx.Background(), os.Args)
+}
+
+// RestartOnSignal calls Restart when the process receives one of the given signals,
+// or SIGUSR2 if no signal is specified, and then gracefully shuts the current process
+// down with the given timeout. The new process is given the same timeout to start serving,
+// after which it is killed.
+// The returned channel receives the error of Restart, in which case the current process
+// keeps serving, or the result of Shutdown.
+func (m *Macross) RestartOnSignal(timeout time.Duration, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGUSR2}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+
+	done := make(chan error, 1)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		ctx, cancel := ktx.WithTimeout(ktx.Background(), timeout)
+		_, err := m.restart(ctx, os.Args)
+		cancel()
+		if err != nil {
+			done <- err
+			return
+		}
+		ctx, cancel = ktx.WithTimeout(ktx.Background(), timeout)
+		defer cancel()
+		done <- m.Shutdown(ctx)
+	}()
+	return done
+}
+
+// restart starts the binary with args and waits until it serves, exits or ctx is done,
+// in which case it is killed.
+func (m *Macross) restart(ctx ktx.Context, args []string) (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	files := make([]*os.File, 0, len(m.listeners))
+	for _, ln := range m.listeners {
+		f, e := listenerFile(ln.Listener)
+		if e != nil {
+			err = e
+			break
+		}
+		files = append(files, f)
+	}
+	m.mutex.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// the new process writes to the pipe once it serves, and closes it when it exits
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, restartFdsEnv+"=") && !strings.HasPrefix(kv, restartReadyEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, restartFdsEnv+"="+strconv.Itoa(len(files)),
+		restartReadyEnv+"="+strconv.Itoa(listenFdsStart+len(files)))
+
+	p, err := os.StartProcess(path, args, &os.ProcAttr{
+		Env:   env,
+		Files: append(append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...), w),
+	})
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		if _, err := ready.Read(make([]byte, 1)); err == nil {
+			started <- nil
+			return
+		}
+		state, err := p.Wait()
+		if err == nil {
+			err = fmt.Errorf("the new process exited before serving: %v", state)
+		}
+		started <- err
+	}()
+	select {
+	case err = <-started:
+	case <-ctx.Done():
+		p.Kill()
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// listenerFile returns a duplicate of the file descriptor of ln.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	switch l := ln.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		// the socket file must outlive this process
+		l.SetUnlinkOnClose(false)
+		return l.File()
+	case *proxyListener:
+		return listenerFile(l.Listener)
+	}
+	return nil, fmt.Errorf("cannot pass %T listening on %s to a new process", ln, ln.Addr())
+}
@@ -0,0 +1,80 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd rumprun
+
+package macross
+
+import (
+	ktx "context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// TestRestartChild is run by TestRestart in the restarted process.
+func TestRestartChild(t *testing.T) {
+	if os.Getenv(restartFdsEnv) == "" {
+		t.Skip("not a restarted process")
+	}
+	lns, err := InheritedListeners()
+	if err != nil || len(lns) != 1 {
+		os.Exit(1)
+	}
+	m := New()
+	m.Get("/", func(c *Context) error {
+		go m.Shutdown(ktx.Background())
+		return c.String("child")
+	})
+	m.Serve(lns[0])
+	os.Exit(0)
+}
+
+// TestRestartFailingChild is run by TestRestart in a restarted process failing at startup.
+func TestRestartFailingChild(t *testing.T) {
+	if os.Getenv(restartFdsEnv) == "" {
+		t.Skip("not a restarted process")
+	}
+	os.Exit(2)
+}
+
+func TestRestart(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String() + "/"
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String("parent")
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- m.Serve(ln)
+	}()
+	_, body, err := fasthttp.Get(nil, url)
+	assert.Nil(t, err)
+	assert.Equal(t, "parent", string(body))
+
+	_, err = m.restart(ktx.Background(), []string{os.Args[0], "-test.run=^TestRestartFailingChild$"})
+	assert.NotNil(t, err, "the new process fails at startup")
+	_, body, err = fasthttp.Get(nil, url)
+	assert.Nil(t, err)
+	assert.Equal(t, "parent", string(body), "the parent keeps serving")
+
+	p, err := m.restart(ktx.Background(), []string{os.Args[0], "-test.run=^TestRestartChild$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	assert.Equal(t, ErrServerClosed, <-served)
+
+	_, body, err = fasthttp.GetTimeout(nil, url, 5*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "child", string(body))
+
+	state, err := p.Wait()
+	assert.Nil(t, err)
+	assert.True(t, state.Success(), "child exited successfully")
+}
@@ -3,6 +3,8 @@ package macross
 import (
 	"fmt"
 	"net/url"
+	"reflect"
+	"runtime"
 	"strings"
 )
 
@@ -11,6 +13,10 @@ type Route struct {
 	group      *RouteGroup
 	name, path string
 	template   string
+	methods    []string  // the methods added so far, in order
+	handlers   []Handler // the handlers registered via Use, run before the handlers of each method
+	consumes   []string  // the media types of the request bodies, see Consumes
+	produces   []string  // the media types of the responses, see Produces
 }
 
 // newRoute creates a new Route with the given route path and route group.
@@ -23,6 +29,7 @@ func newRoute(path string, group *RouteGroup) *Route {
 		path = path[:len(path)-1] + "<:.*>"
 	}
 
+	group.macross.checkNotFrozen("add route " + group.hostPattern() + name)
 	route := &Route{
 		group:    group,
 		name:     name,
@@ -35,10 +42,30 @@ func newRoute(path string, group *RouteGroup) *Route {
 }
 
 // Name sets the name of the route.
-// This method will update the registration of the route in the macross as well.
+// This method will update the registration of the route in the macross as well,
+// and calls the OnRouteRenamed hooks if methods were already added.
 func (r *Route) Name(name string) *Route {
+	r.group.macross.checkNotFrozen("name route " + r.group.hostPattern() + r.path)
+	previous := r.name
 	r.name = name
 	r.group.macross.routes[name] = r
+	if len(r.methods) > 0 {
+		r.group.macross.routeRenamed(r.path, previous, name)
+	}
+	return r
+}
+
+// Use registers one or multiple handlers to the route. They are run after the handlers of the route group
+// and before the handlers of each method of the route, which must be added afterwards:
+//
+//	m.Path("/admin").Use(auth).Get(showAdmin).Post(updateAdmin)
+//
+// It panics if a method was already added, as its handlers would run without them.
+// The route group is left unchanged.
+func (r *Route) Use(handlers ...Handler) *Route {
+	r.group.macross.checkNotFrozen("call Use on route " + r.group.hostPattern() + r.path)
+	r.checkNoMethods("Use")
+	r.handlers = combineHandlers(r.handlers, handlers)
 	return r
 }
 
@@ -114,13 +141,55 @@ func (r *Route) URL(pairs ...interface{}) (s string) {
 }
 
 // add registers the route, the specified HTTP method and the handlers to the macross.
-// The handlers will be combined with the handlers of the route group.
+// The handlers will be combined with the handlers of the route group and the route.
 func (r *Route) add(method string, handlers []Handler) *Route {
+	handlers = combineHandlers(r.handlers, handlers)
 	hh := combineHandlers(r.group.handlers, handlers)
-	r.group.macross.add(method, r.path, hh)
+	path, types := r.group.macross.expandParamTypes(r.path)
+	r.group.macross.checkNotFrozen("register " + method + " " + r.group.hostPattern() + r.path)
+	source := callerSource()
+	if types != nil {
+		// the typed parameters are converted right before the handlers of the route
+		handlers = append([]Handler{convertParams(types)}, handlers...)
+	}
+	if len(r.consumes) == 0 && len(r.produces) == 0 {
+		r.group.macross.checkConflicts(r, method, path, source)
+		r.group.macross.add(r.group.host, method, path, combineHandlers(r.group.handlers, handlers))
+		r.group.macross.register(method, r, path, hh, source)
+	} else if rs, first := r.group.macross.mediaRoutes(r, method, path); first {
+		r.group.macross.checkConflicts(r, method, path, source)
+		r.group.macross.add(r.group.host, method, path, rs.add(r, path, handlers))
+		r.group.macross.register(method, r, path, hh, source)
+	} else {
+		// the route is an alternative to the first one with other media types, which negotiates them
+		rs.add(r, path, handlers)
+		r.group.macross.table = append(r.group.macross.table, routeEntry{method: method, route: r, path: path, handlers: hh, source: source})
+	}
+	if !r.hasMethod(method) {
+		r.methods = append(r.methods, method)
+	}
+	r.group.macross.publishRouting()
+	r.group.macross.routeAdded(method, r.path, r.name)
 	return r
 }
 
+// checkNoMethods panics if a method was added to the route, which a route setting would not apply to.
+func (r *Route) checkNoMethods(setting string) {
+	if len(r.methods) > 0 {
+		panic("macross: cannot call " + setting + " on route " + r.group.hostPattern() + r.path + " after its methods " +
+			strings.Join(r.methods, ", ") + " were added (" + callerSource() + "): call it before adding them")
+	}
+}
+
+func (r *Route) hasMethod(method string) bool {
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // buildURLTemplate converts a route pattern into a URL template by removing regular expressions in parameter tokens.
 func buildURLTemplate(path string) string {
 	template, start, end := "", -1, -1
@@ -148,6 +217,17 @@ func buildURLTemplate(path string) string {
 	return template
 }
 
+// HandlerName returns the name of the function of a handler, such as "main.(*UserController).Show-fm".
+func HandlerName(h Handler) string {
+	if h == nil {
+		return ""
+	}
+	if f := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
 // combineHandlers merges two lists of handlers into a new list.
 func combineHandlers(h1 []Handler, h2 []Handler) []Handler {
 	hh := make([]Handler, len(h1)+len(h2))
@@ -3,9 +3,12 @@ package macross
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
 )
 
 type mockStore struct {
@@ -55,6 +58,61 @@ func TestRouteName(t *testing.T) {
 	assert.True(t, exists, "router.routes[name] is ")
 }
 
+func TestRouteAddedHooks(t *testing.T) {
+	router := New()
+	var added []string
+	router.OnRouteAdded(func(method, path, name string) {
+		added = append(added, method+" "+path+" "+name)
+	})
+	router.OnRouteRenamed(func(path, previous, name string) {
+		added = append(added, "rename "+path+" "+previous+" "+name)
+	})
+	router.Get("/users/<id>", nil).Post(nil).Name("user")
+	router.Group("/admin").To("GET,PUT", "/*", nil)
+	router.Path("/posts").Name("posts").Get(nil)
+	assert.Equal(t, []string{
+		"GET /users/<id> /users/<id>",
+		"POST /users/<id> /users/<id>",
+		"rename /users/<id> /users/<id> user",
+		"GET /admin/<:.*> /admin/*",
+		"PUT /admin/<:.*> /admin/*",
+		"GET /posts posts",
+	}, added)
+}
+
+func routesTestHandler(c *Context) error {
+	return nil
+}
+
+type routesTestController struct{}
+
+func (routesTestController) Show(c *Context) error {
+	return nil
+}
+
+func TestMacrossRoutes(t *testing.T) {
+	router := New()
+	router.Use(routesTestHandler)
+	router.Get("/users", routesTestHandler)
+	router.Get("/users/<id>", routesTestController{}.Show).Put(routesTestHandler).Name("user")
+	router.Group("/admin").Post("/*", routesTestHandler)
+	router.Get("/users", routesTestController{}.Show)
+
+	routes := router.Routes()
+	assert.Equal(t, 4, len(routes))
+	assert.Equal(t, RouteInfo{
+		Method:   GET,
+		Path:     "/users",
+		Name:     "/users",
+		Handlers: []string{"github.com/insionng/macross.routesTestHandler", "github.com/insionng/macross.routesTestHandler"},
+	}, routes[0], "the first of duplicate routes is listed")
+	assert.Equal(t, "user", routes[1].Name)
+	assert.Equal(t, PUT, routes[2].Method)
+	assert.Equal(t, "/users/<id>", routes[2].Path)
+	assert.Equal(t, "POST /admin/<:.*> (/admin/*) github.com/insionng/macross.routesTestHandler, github.com/insionng/macross.routesTestHandler", routes[3].String())
+	assert.Equal(t, "GET /users/<id> (user) github.com/insionng/macross.routesTestHandler, github.com/insionng/macross.routesTestController.Show-fm", routes[1].String())
+}
+
 func TestRouteURL(t *testing.T) {
 	router := New()
 	group := newRouteGroup("/admin", router, nil)
@@ -154,3 +212,189 @@ func TestBuildURLTemplate(t *testing.T) {
 		assert.Equal(t, test.expected, actual, "buildURLTemplate("+test.path+") =")
 	}
 }
+
+func TestRouteParamValues(t *testing.T) {
+	var retained []string
+	m := New()
+	m.Get("/users/<id>/posts/<post>", func(c *Context) error {
+		retained = append(retained, c.Param("id").String(), c.Parameter(1))
+		return nil
+	})
+	m.Get("/users/<id>", func(c *Context) error {
+		retained = append(retained, c.Param("id").String(), c.Param("post").String())
+		return nil
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	for _, path := range []string{"/users/42/posts/hello", "/users/7", "/users/1024/posts/bye"} {
+		ctx.Request.SetRequestURI(path)
+		m.ServeHTTP(ctx)
+	}
+	assert.Equal(t, []string{"42", "hello", "7", "", "1024", "bye"}, retained, "the values outlive the request")
+}
+
+func TestSwapRoutes(t *testing.T) {
+	serve := func(m *Macross, path string) (int, string) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(path)
+		m.ServeHTTP(ctx)
+		return ctx.Response.StatusCode(), string(ctx.Response.Body())
+	}
+
+	m := New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	m.Get("/old", func(c *Context) error {
+		close(entered)
+		<-release
+		return c.String("old")
+	})
+	m.Get("/users/<id>", func(c *Context) error {
+		return c.String("user " + c.Param("id").String())
+	})
+	serve(m, "/users/1") // the pooled context has a single parameter value
+
+	next := New()
+	next.Use(func(c *Context) error {
+		c.Response.Header.Set("X-Table", "next")
+		return nil
+	})
+	reverse := func(c *Context) error {
+		return c.String(c.URL("new", "a", c.Param("c"), "b", c.Param("b"), "c", c.Param("a")))
+	}
+	next.Get("/new/<a>/<b>/<c>", reverse).Name("new")
+
+	done := make(chan string)
+	go func() {
+		_, body := serve(m, "/old")
+		done <- body
+	}()
+	<-entered
+	m.SwapRoutes(next)
+	close(release)
+	assert.Equal(t, "old", <-done, "an in-flight request finishes on the old routes")
+
+	status, _ := serve(m, "/old")
+	assert.Equal(t, StatusNotFound, status)
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/new/x/y/z")
+	m.ServeHTTP(ctx)
+	assert.Equal(t, "/new/z/y/x", string(ctx.Response.Body()))
+	assert.Equal(t, "next", string(ctx.Response.Header.Peek("X-Table")), "the middleware of the new routes")
+	assert.Equal(t, "/new/1/2/3", m.Route("new").URL("a", 1, "b", 2, "c", 3))
+	assert.Equal(t, 1, len(m.Routes()))
+
+	// requests are served while the routes are swapped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if status, body := serve(m, "/new/x/y/z"); status != StatusOK || body != "/new/z/y/x" {
+					t.Errorf("unexpected response %v %q", status, body)
+				}
+				if len(m.Routes()) != 1 || m.Route("new") == nil {
+					t.Errorf("unexpected routes %v", m.Routes())
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		next := New()
+		next.Get("/new/<a>/<b>/<c>", reverse).Name("new")
+		m.SwapRoutes(next)
+	}
+	wg.Wait()
+}
+
+func TestFreeze(t *testing.T) {
+	h := func(c *Context) error { return c.String("ok") }
+	m := New()
+	m.Get("/users/<id>", h)
+	blog := New()
+	blog.Get("/posts", h)
+	m.Mount("/blog", blog)
+	route := m.Path("/posts")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/blog/posts")
+	m.ServeHTTP(ctx)
+	assert.Equal(t, "ok", string(ctx.Response.Body()))
+
+	defer func() {
+		msg := fmt.Sprint(recover())
+		assert.True(t, strings.HasPrefix(msg, "macross: cannot add route /users/<id>/posts/<post> once the macross is frozen ("+packageDir+"/route_test.go:"), msg)
+		assert.True(t, strings.HasSuffix(msg, "use SwapRoutes to replace the routes of a serving macross"), msg)
+
+		assert.Panics(t, func() { m.Use(h) }, "frozen on the first request")
+		assert.Panics(t, func() { m.NotFound(h) })
+		assert.Panics(t, func() { m.Host("api.example.com") })
+		assert.Panics(t, func() { blog.Get("/posts/<id>", h) }, "mounted macross frozen on its first request")
+		assert.Panics(t, func() { m.Path("/about") })
+		assert.Panics(t, func() { route.Name("posts") })
+		assert.Panics(t, func() { route.Use(h) })
+		assert.Panics(t, func() { route.Consumes(MIMEApplicationJSON) })
+		assert.Panics(t, func() { route.Produces(MIMEApplicationJSON) })
+		assert.Panics(t, func() { route.Get(h) })
+		assert.Panics(t, func() { m.SetParamType("id", ParamType{Pattern: `\d+`}) })
+		_, named := m.currentRouting().routes["posts"]
+		assert.False(t, named, "the routes are unchanged")
+		assert.NotPanics(t, func() { m.Freeze() })
+	}()
+	m.Get("/users/<id>/posts/<post>", h)
+}
+
+func TestFreezeValidates(t *testing.T) {
+	m := New()
+	m.Get("/users", func(c *Context) error { return nil })
+	m.Freeze()
+	assert.Panics(t, func() { m.Get("/posts", func(c *Context) error { return nil }) })
+
+	m = New()
+	m.Get("/users")
+	assert.Panics(t, func() { m.Freeze() }, "a route without handlers")
+
+	m = New()
+	m.Get("/users")
+	assert.Panics(t, func() { New().SwapRoutes(m) }, "the new routes are validated")
+}
+
+func benchmarkRoute(b *testing.B, path string, handler Handler) {
+	m := New()
+	m.Get("/users/<id>/edit", handler)
+	m.Get("/users", handler)
+	m.Get("/users/new", handler)
+	m.Get("/users/<id>", handler)
+	m.Get("/users/<id>/posts/<post>", handler)
+	m.Post("/users/<id>", handler)
+	m.Get("/static/*", handler)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI(path)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.ServeHTTP(ctx)
+	}
+}
+
+func BenchmarkRouteStatic(b *testing.B) {
+	benchmarkRoute(b, "/users/new", func(c *Context) error {
+		return nil
+	})
+}
+
+func BenchmarkRouteParam(b *testing.B) {
+	benchmarkRoute(b, "/users/42/posts/hello", func(c *Context) error {
+		if c.Param("id").MustInt() != 42 || !c.Param("post").Exist() {
+			b.Fatal("unexpected parameters")
+		}
+		return nil
+	})
+}
+
+func BenchmarkRouteWildcard(b *testing.B) {
+	benchmarkRoute(b, "/static/css/site.css", func(c *Context) error {
+		return nil
+	})
+}
@@ -0,0 +1,577 @@
+package macross
+
+import (
+	ktx "context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type (
+	// ServerConfig defines the config for the fasthttp server started by the Listen methods.
+	ServerConfig struct {
+		// Name is sent in the Server response header.
+		// Optional. Default value "Macross".
+		Name string `json:"name"`
+
+		// Concurrency is the maximum number of concurrent connections.
+		// Optional. Default value fasthttp.DefaultConcurrency.
+		Concurrency int `json:"concurrency"`
+
+		// ReadTimeout is the maximum duration for reading a full request, including the body.
+		// Optional. Unlimited by default.
+		ReadTimeout time.Duration `json:"read_timeout"`
+
+		// WriteTimeout is the maximum duration for writing a full response.
+		// Optional. Unlimited by default.
+		WriteTimeout time.Duration `json:"write_timeout"`
+
+		// IdleTimeout is the maximum duration to wait for the next request on a keep-alive connection.
+		// Optional. ReadTimeout is used if unset.
+		IdleTimeout time.Duration `json:"idle_timeout"`
+
+		// MaxKeepaliveDuration is the maximum lifetime of a keep-alive connection.
+		// Optional. Unlimited by default.
+		MaxKeepaliveDuration time.Duration `json:"max_keepalive_duration"`
+
+		// MaxRequestBodySize is the maximum request body size in bytes.
+		// Optional. Default value fasthttp.DefaultMaxRequestBodySize.
+		MaxRequestBodySize int `json:"max_request_body_size"`
+
+		// MaxConnsPerIP is the maximum number of concurrent connections per client IP.
+		// Optional. Unlimited by default.
+		MaxConnsPerIP int `json:"max_conns_per_ip"`
+
+		// MaxRequestsPerConn is the maximum number of requests served per connection.
+		// Optional. Unlimited by default.
+		MaxRequestsPerConn int `json:"max_requests_per_conn"`
+
+		// ReadBufferSize is the per-connection buffer size for reading requests.
+		// It also limits the maximum header size.
+		// Optional. fasthttp default is used if unset.
+		ReadBufferSize int `json:"read_buffer_size"`
+
+		// WriteBufferSize is the per-connection buffer size for writing responses.
+		// Optional. fasthttp default is used if unset.
+		WriteBufferSize int `json:"write_buffer_size"`
+
+		// DisableKeepalive closes every connection after sending the first response.
+		DisableKeepalive bool `json:"disable_keepalive"`
+
+		// ReduceMemoryUsage trades CPU for memory on mostly idle keep-alive connections.
+		ReduceMemoryUsage bool `json:"reduce_memory_usage"`
+
+		// Logger receives the errors of the fasthttp server.
+		// Optional. fasthttp logs to stderr by default.
+		Logger fasthttp.Logger
+
+		// TLSConfig makes Listen, ListenUnix and Serve accept HTTPS connections only.
+		// See `CertReloader` for serving several certificates that are reloaded at runtime.
+		// Optional. Ignored by ListenTLS and ListenTLSEmbed.
+		TLSConfig *tls.Config
+
+		// ProxyProtocol makes the server read the client address from the PROXY protocol
+		// header sent by trusted load balancers. See `NewProxyListener`.
+		// Optional. Disabled if nil.
+		ProxyProtocol *ProxyProtocolConfig
+	}
+
+	// trackedListener wraps a net.Listener so that Shutdown can close it
+	// and reach every connection it has accepted.
+	trackedListener struct {
+		net.Listener
+		macross     *Macross
+		idleTimeout time.Duration
+		once        sync.Once
+		closeErr    error
+	}
+
+	// trackedConn records whether the connection is idle between requests and
+	// removes itself from the macross connection set when closed.
+	trackedConn struct {
+		net.Conn
+		macross      *Macross
+		once         sync.Once
+		closed       int32         // set to 1 once the connection has been closed
+		state        int32         // connIdle or connActive
+		wrote        bool          // whether a response was written since the last request was read
+		idleTimeout  time.Duration // the read deadline applied while waiting for the next request
+		readDeadline time.Time     // the read deadline requested by the server
+		idling       bool          // whether the idle deadline is in effect
+	}
+)
+
+var (
+	// DefaultServerConfig is the default config used by Listen, ListenTLS and ListenTLSEmbed.
+	DefaultServerConfig = ServerConfig{
+		Name: "Macross",
+	}
+)
+
+// Connection states
+const (
+	connIdle int32 = iota
+	connActive
+)
+
+// shutdownPollInterval is how often Shutdown checks whether the in-flight handlers have finished.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Listen serves HTTP requests on the given address with DefaultServerConfig until Shutdown is called.
+// It returns ErrServerClosed after a graceful shutdown.
+func (m *Macross) Listen(args ...interface{}) error {
+	return m.ListenWithConfig(DefaultServerConfig, args...)
+}
+
+// ListenWithConfig serves HTTP requests on the given address with config.
+// See: `Listen()`.
+func (m *Macross) ListenWithConfig(config ServerConfig, args ...interface{}) error {
+	ln, err := listen(GetAddress(args...))
+	if err != nil {
+		return err
+	}
+	return m.serve(ln, config, serveListener(config))
+}
+
+// ListenTLS serves HTTPS requests on the given address with the certificate and key files.
+// It returns ErrServerClosed after a graceful shutdown.
+func (m *Macross) ListenTLS(certFile, keyFile string, args ...interface{}) error {
+	return m.ListenTLSWithConfig(DefaultServerConfig, certFile, keyFile, args...)
+}
+
+// ListenTLSWithConfig serves HTTPS requests on the given address with config.
+// See: `ListenTLS()`.
+func (m *Macross) ListenTLSWithConfig(config ServerConfig, certFile, keyFile string, args ...interface{}) error {
+	ln, err := listen(GetAddress(args...))
+	if err != nil {
+		return err
+	}
+	return m.serve(ln, config, func(s *fasthttp.Server, ln net.Listener) error {
+		return s.ServeTLS(ln, certFile, keyFile)
+	})
+}
+
+// ListenTLSEmbed serves HTTPS requests on the given address with the certificate and key data.
+// It returns ErrServerClosed after a graceful shutdown.
+func (m *Macross) ListenTLSEmbed(certData, keyData []byte, args ...interface{}) error {
+	return m.ListenTLSEmbedWithConfig(DefaultServerConfig, certData, keyData, args...)
+}
+
+// ListenTLSEmbedWithConfig serves HTTPS requests on the given address with config.
+// See: `ListenTLSEmbed()`.
+func (m *Macross) ListenTLSEmbedWithConfig(config ServerConfig, certData, keyData []byte, args ...interface{}) error {
+	ln, err := listen(GetAddress(args...))
+	if err != nil {
+		return err
+	}
+	return m.serve(ln, config, func(s *fasthttp.Server, ln net.Listener) error {
+		return s.ServeTLSEmbed(ln, certData, keyData)
+	})
+}
+
+// ListenUnix serves HTTP requests on the unix socket at path with DefaultServerConfig.
+// A socket left at path by a previous run is removed first, while any other existing file
+// makes it return an error. The socket file is given the mode.
+// It returns ErrServerClosed after a graceful shutdown.
+func (m *Macross) ListenUnix(path string, mode os.FileMode) error {
+	return m.ListenUnixWithConfig(DefaultServerConfig, path, mode)
+}
+
+// ListenUnixWithConfig serves HTTP requests on the unix socket at path with config.
+// See: `ListenUnix()`.
+func (m *Macross) ListenUnixWithConfig(config ServerConfig, path string, mode os.FileMode) error {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return errors.New("cannot listen on " + path + ": the file exists and is not a socket")
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return err
+	}
+	return m.serve(ln, config, serveListener(config))
+}
+
+// Serve serves HTTP requests from an already opened listener with DefaultServerConfig,
+// e.g. one inherited through socket activation.
+// The listener is closed by Shutdown, and ErrServerClosed is returned afterwards.
+func (m *Macross) Serve(ln net.Listener) error {
+	return m.ServeWithConfig(DefaultServerConfig, ln)
+}
+
+// ServeWithConfig serves HTTP requests from an already opened listener with config.
+// See: `Serve()`.
+func (m *Macross) ServeWithConfig(config ServerConfig, ln net.Listener) error {
+	return m.serve(ln, config, serveListener(config))
+}
+
+// serveListener returns how a server built from config consumes its listener.
+func serveListener(config ServerConfig) func(*fasthttp.Server, net.Listener) error {
+	if config.TLSConfig == nil {
+		return (*fasthttp.Server).Serve
+	}
+	return func(s *fasthttp.Server, ln net.Listener) error {
+		return s.Serve(tls.NewListener(ln, config.TLSConfig))
+	}
+}
+
+// NewServer creates a fasthttp server dispatching requests to the macross with the given config.
+func (m *Macross) NewServer(config ServerConfig) *fasthttp.Server {
+	if config.Name == "" {
+		config.Name = DefaultServerConfig.Name
+	}
+	return &fasthttp.Server{
+		Handler:              m.ServeHTTP,
+		Name:                 config.Name,
+		Concurrency:          config.Concurrency,
+		ReadTimeout:          config.ReadTimeout,
+		WriteTimeout:         config.WriteTimeout,
+		MaxKeepaliveDuration: config.MaxKeepaliveDuration,
+		MaxRequestBodySize:   config.MaxRequestBodySize,
+		MaxConnsPerIP:        config.MaxConnsPerIP,
+		MaxRequestsPerConn:   config.MaxRequestsPerConn,
+		ReadBufferSize:       config.ReadBufferSize,
+		WriteBufferSize:      config.WriteBufferSize,
+		DisableKeepalive:     config.DisableKeepalive,
+		ReduceMemoryUsage:    config.ReduceMemoryUsage,
+		Logger:               config.Logger,
+	}
+}
+
+// serve runs a fasthttp server built from config on ln until the listener fails or Shutdown is called.
+// The serve function decides how the server consumes the listener (plain or TLS).
+func (m *Macross) serve(ln net.Listener, config ServerConfig, serve func(*fasthttp.Server, net.Listener) error) error {
+	// invalid routes panic at startup rather than in the handler of the first request
+	m.Freeze()
+	tl := m.trackListener(ln)
+	if tl == nil {
+		return ErrServerClosed
+	}
+	tl.idleTimeout = config.IdleTimeout
+	defer m.untrackListener(tl)
+
+	// the PROXY listener wraps the tracked one, so that the raw listener can be handed over on restart
+	var sl net.Listener = tl
+	if config.ProxyProtocol != nil {
+		var err error
+		if sl, err = NewProxyListener(tl, *config.ProxyProtocol); err != nil {
+			tl.Close()
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	hooks := make([]func(net.Addr) error, len(m.startHooks))
+	copy(hooks, m.startHooks)
+	m.mutex.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ln.Addr()); err != nil {
+			tl.Close()
+			return err
+		}
+	}
+	notifyRestarted()
+
+	err := serve(m.NewServer(config), sl)
+	if m.ShuttingDown() {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// OnStart registers functions that are called with the bound address whenever a listener
+// starts serving. If one of them fails, the listener is closed and its error is returned
+// by the Listen method or Serve.
+func (m *Macross) OnStart(hooks ...func(addr net.Addr) error) {
+	m.mutex.Lock()
+	m.startHooks = append(m.startHooks, hooks...)
+	m.mutex.Unlock()
+}
+
+// OnShutdown registers functions that are called by Shutdown once the in-flight requests
+// have been drained or the shutdown context is done.
+func (m *Macross) OnShutdown(hooks ...func(ktx.Context) error) {
+	m.mutex.Lock()
+	m.shutdownHooks = append(m.shutdownHooks, hooks...)
+	m.mutex.Unlock()
+}
+
+// SetShutdownDelay sets how long Shutdown keeps accepting connections before closing the listeners.
+// During the delay the macross is already shutting down, so that readiness probes such as the one
+// of the health package fail and load balancers stop sending requests to the instance, while the
+// requests they send until they notice are still served. The delay ends early if the shutdown
+// context is done.
+func (m *Macross) SetShutdownDelay(delay time.Duration) {
+	m.mutex.Lock()
+	m.shutdownDelay = delay
+	m.mutex.Unlock()
+}
+
+// Shutdown gracefully stops the macross servers without interrupting active requests.
+// It waits for the delay set via SetShutdownDelay, closes all listeners, then repeatedly closes the idle connections until every
+// connection has finished its current request, and finally calls the hooks registered
+// via OnShutdown. If ctx is done before the connections are drained, the remaining
+// connections are closed and the context error is returned.
+//
+// Once Shutdown has been called, Listen and its variants return ErrServerClosed.
+// Note that they return as soon as the listeners are closed, so the program should
+// wait for Shutdown to return before exiting.
+func (m *Macross) Shutdown(ctx ktx.Context) error {
+	atomic.StoreInt32(&m.inShutdown, 1)
+
+	m.mutex.Lock()
+	delay := m.shutdownDelay
+	m.mutex.Unlock()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	m.mutex.Lock()
+	var err error
+	for _, ln := range m.listeners {
+		if e := ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	hooks := make([]func(ktx.Context) error, len(m.shutdownHooks))
+	copy(hooks, m.shutdownHooks)
+	m.mutex.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+drain:
+	for !m.closeIdleConns() {
+		select {
+		case <-ctx.Done():
+			m.closeConns()
+			err = ctx.Err()
+			break drain
+		case <-ticker.C:
+		}
+	}
+
+	for _, hook := range hooks {
+		if e := hook(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ShutdownOnSignal calls Shutdown with the given timeout when the process receives
+// one of the given signals, or SIGINT and SIGTERM if no signal is specified.
+// The returned channel receives the result of Shutdown.
+func (m *Macross) ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+
+	done := make(chan error, 1)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		ctx, cancel := ktx.WithTimeout(ktx.Background(), timeout)
+		defer cancel()
+		done <- m.Shutdown(ctx)
+	}()
+	return done
+}
+
+// listenNetwork returns the network to listen on for addr: "tcp6" for an IPv6 host,
+// "tcp" (dual-stack) for an empty host or the unspecified IPv6 address, and "tcp4" otherwise.
+func listenNetwork(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "tcp4"
+	}
+	if host == "" || host == "::" {
+		return "tcp"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "tcp6"
+	}
+	return "tcp4"
+}
+
+// ShuttingDown reports whether Shutdown has been called,
+// on the macross or on the one it is mounted on.
+func (m *Macross) ShuttingDown() bool {
+	return atomic.LoadInt32(&m.inShutdown) != 0 || (m.parent != nil && m.parent.ShuttingDown())
+}
+
+// trackListener registers the listener so that Shutdown closes it. If Shutdown has already
+// been called, it closes the listener and returns nil. The check is made while holding the mutex,
+// so that Shutdown closes the listeners registered before it.
+func (m *Macross) trackListener(ln net.Listener) *trackedListener {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.ShuttingDown() {
+		ln.Close()
+		return nil
+	}
+	tl := &trackedListener{Listener: ln, macross: m}
+	m.listeners = append(m.listeners, tl)
+	return tl
+}
+
+func (m *Macross) untrackListener(tl *trackedListener) {
+	m.mutex.Lock()
+	for i, ln := range m.listeners {
+		if ln == tl {
+			m.listeners = append(m.listeners[:i], m.listeners[i+1:]...)
+			break
+		}
+	}
+	m.mutex.Unlock()
+}
+
+// closeIdleConns closes the tracked connections that are waiting for a request.
+// It reports whether no connection is left.
+func (m *Macross) closeIdleConns() bool {
+	m.mutex.Lock()
+	total := len(m.conns)
+	idle := make([]*trackedConn, 0, total)
+	for c := range m.conns {
+		if atomic.LoadInt32(&c.state) == connIdle {
+			idle = append(idle, c)
+		}
+	}
+	m.mutex.Unlock()
+	for _, c := range idle {
+		c.Close()
+	}
+	return len(idle) == total
+}
+
+func (m *Macross) closeConns() {
+	m.mutex.Lock()
+	conns := make([]*trackedConn, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	m.mutex.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Accept waits for and returns the next tracked connection.
+func (l *trackedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: c, macross: l.macross, idleTimeout: l.idleTimeout}
+	l.macross.mutex.Lock()
+	if l.macross.conns == nil {
+		l.macross.conns = make(map[*trackedConn]struct{})
+	}
+	l.macross.conns[tc] = struct{}{}
+	l.macross.mutex.Unlock()
+	return tc, nil
+}
+
+// Close closes the underlying listener once.
+func (l *trackedListener) Close() error {
+	l.once.Do(func() {
+		l.closeErr = l.Listener.Close()
+	})
+	return l.closeErr
+}
+
+// Read marks the connection active once request data arrives.
+// A read following a written response means the previous request is complete,
+// so the idle timeout applies until the next request starts.
+func (c *trackedConn) Read(b []byte) (int, error) {
+	if c.wrote {
+		c.wrote = false
+		atomic.StoreInt32(&c.state, connIdle)
+		if c.idleTimeout > 0 {
+			deadline := time.Now().Add(c.idleTimeout)
+			if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+				deadline = c.readDeadline
+			}
+			c.Conn.SetReadDeadline(deadline)
+			c.idling = true
+		}
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.StoreInt32(&c.state, connActive)
+		if c.idling {
+			c.idling = false
+			c.Conn.SetReadDeadline(c.readDeadline)
+		}
+	}
+	return n, err
+}
+
+// SetReadDeadline records the deadline requested by the server so that it
+// can be restored once an idle period ends.
+func (c *trackedConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.ignoreClosed(c.Conn.SetReadDeadline(t))
+}
+
+// SetWriteDeadline sets the write deadline of the connection.
+func (c *trackedConn) SetWriteDeadline(t time.Time) error {
+	return c.ignoreClosed(c.Conn.SetWriteDeadline(t))
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *trackedConn) SetDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.ignoreClosed(c.Conn.SetDeadline(t))
+}
+
+// ignoreClosed drops the error of setting a deadline on a closed connection. fasthttp panics
+// if setting a deadline fails, which happens when Shutdown closes the connections still in use
+// once its context is done, or an idle connection that was just accepted.
+// The next read or write of the connection fails instead.
+func (c *trackedConn) ignoreClosed(err error) error {
+	if err != nil && atomic.LoadInt32(&c.closed) != 0 {
+		return nil
+	}
+	return err
+}
+
+// Write writes response data to the connection.
+func (c *trackedConn) Write(b []byte) (int, error) {
+	c.wrote = true
+	return c.Conn.Write(b)
+}
+
+// Close closes the connection and stops tracking it.
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		c.macross.mutex.Lock()
+		delete(c.macross.conns, c)
+		c.macross.mutex.Unlock()
+	})
+	return c.Conn.Close()
+}
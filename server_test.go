@@ -0,0 +1,456 @@
+package macross
+
+import (
+	"bufio"
+	ktx "context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func startTestServer(t *testing.T, m *Macross, config ServerConfig) (string, chan error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- m.serve(ln, config, (*fasthttp.Server).Serve)
+	}()
+	return "http://" + ln.Addr().String(), served
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	m := New()
+	m.Get("/slow", func(c *Context) error {
+		close(started)
+		<-release
+		return c.String("done")
+	})
+	hooked := false
+	m.OnShutdown(func(ktx.Context) error {
+		hooked = true
+		return nil
+	})
+	url, served := startTestServer(t, m, DefaultServerConfig)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		status, body, err := fasthttp.Get(nil, url+"/slow")
+		responses <- result{status, string(body), err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- m.Shutdown(ktx.Background())
+	}()
+	assert.Equal(t, ErrServerClosed, <-served, "serve error =")
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	r := <-responses
+	assert.Nil(t, r.err)
+	assert.Equal(t, StatusOK, r.status)
+	assert.Equal(t, "done", r.body)
+	assert.Nil(t, <-shutdown)
+	assert.True(t, hooked, "shutdown hook called")
+
+	_, _, err := fasthttp.Get(nil, url+"/slow")
+	assert.NotNil(t, err, "request after shutdown")
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	m := New()
+	m.Get("/slow", func(c *Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	url, served := startTestServer(t, m, DefaultServerConfig)
+	go fasthttp.Get(nil, url+"/slow")
+	<-started
+
+	ctx, cancel := ktx.WithTimeout(ktx.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ktx.DeadlineExceeded, m.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-served)
+}
+
+func TestShutdownDeadlineTimeouts(t *testing.T) {
+	started, release, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	m := New()
+	m.Get("/slow", func(c *Context) error {
+		defer close(finished)
+		close(started)
+		<-release
+		return c.String("done")
+	})
+	url, served := startTestServer(t, m, ServerConfig{ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second})
+	go fasthttp.Get(nil, url+"/slow")
+	<-started
+
+	ctx, cancel := ktx.WithTimeout(ktx.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ktx.DeadlineExceeded, m.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-served)
+
+	// the server sets the write deadline of the closed connection once the handler returns
+	close(release)
+	<-finished
+	time.Sleep(100 * time.Millisecond)
+
+	a, b := net.Pipe()
+	defer b.Close()
+	tc := &trackedConn{Conn: a, macross: m}
+	assert.Nil(t, tc.SetReadDeadline(time.Now()))
+	assert.Nil(t, tc.Close())
+	assert.Nil(t, tc.SetReadDeadline(time.Now()), "deadline of a closed connection")
+	assert.Nil(t, tc.SetWriteDeadline(time.Now()))
+	assert.Nil(t, tc.SetDeadline(time.Now()))
+}
+
+func TestShutdownDelay(t *testing.T) {
+	m := New()
+	m.Get("/ready", func(c *Context) error {
+		if c.Macross().ShuttingDown() {
+			return c.NoContent(StatusServiceUnavailable)
+		}
+		return c.NoContent(StatusOK)
+	})
+	m.SetShutdownDelay(200 * time.Millisecond)
+	url, served := startTestServer(t, m, DefaultServerConfig)
+	status, _, err := fasthttp.Get(nil, url+"/ready")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusOK, status)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- m.Shutdown(ktx.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	status, _, err = fasthttp.Get(nil, url+"/ready")
+	assert.Nil(t, err, "request during the delay")
+	assert.Equal(t, StatusServiceUnavailable, status)
+	select {
+	case <-served:
+		t.Fatal("the listener was closed before the delay elapsed")
+	default:
+	}
+
+	assert.Equal(t, ErrServerClosed, <-served)
+	assert.Nil(t, <-shutdown)
+	_, _, err = fasthttp.Get(nil, url+"/ready")
+	assert.NotNil(t, err, "request after the delay")
+
+	m = New()
+	m.SetShutdownDelay(time.Hour)
+	ctx, cancel := ktx.WithTimeout(ktx.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Nil(t, m.Shutdown(ctx))
+	assert.True(t, time.Since(start) < time.Second, "the delay ends with the context")
+}
+
+func TestServeFreezes(t *testing.T) {
+	m := New()
+	m.Get("/users")
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	assert.Panics(t, func() { m.Serve(ln) }, "a route without handlers panics at startup")
+	assert.Panics(t, func() { m.Freeze() }, "a failed freeze panics again")
+	assert.Panics(t, func() { m.ServeHTTP(&fasthttp.RequestCtx{}) })
+
+	m = New()
+	m.Get("/users", func(c *Context) error { return nil })
+	started := make(chan struct{})
+	m.OnStart(func(net.Addr) error {
+		close(started)
+		return nil
+	})
+	_, served := startTestServer(t, m, DefaultServerConfig)
+	<-started
+	assert.Panics(t, func() { m.Get("/posts", func(c *Context) error { return nil }) }, "frozen before serving")
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	assert.Equal(t, ErrServerClosed, <-served)
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	m := New()
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	_, served := startTestServer(t, m, DefaultServerConfig)
+	assert.Equal(t, ErrServerClosed, <-served)
+}
+
+func TestStartAndErrorHooks(t *testing.T) {
+	m := New()
+	m.Get("/fail", func(c *Context) error {
+		return NewHTTPError(StatusTeapot, "teapot")
+	})
+	errs := make(chan error, 1)
+	m.OnError(func(c *Context, err error) {
+		assert.Equal(t, "/fail", string(c.Path()))
+		errs <- err
+	})
+	addrs := make(chan net.Addr, 1)
+	m.OnStart(func(addr net.Addr) error {
+		addrs <- addr
+		return nil
+	})
+	url, _ := startTestServer(t, m, DefaultServerConfig)
+	defer m.Shutdown(ktx.Background())
+	assert.Equal(t, url, "http://"+(<-addrs).String())
+
+	status, body, err := fasthttp.Get(nil, url+"/fail")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusTeapot, status)
+	assert.Equal(t, "teapot", string(body))
+	assert.Equal(t, "teapot", (<-errs).Error())
+
+	// a failing start hook stops the server
+	m = New()
+	m.OnStart(func(net.Addr) error {
+		return ErrServerClosed
+	})
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ErrServerClosed, m.Serve(ln))
+	_, err = net.Dial("tcp4", ln.Addr().String())
+	assert.NotNil(t, err, "listener closed")
+}
+
+func TestServerConfig(t *testing.T) {
+	m := New()
+	m.Post("/echo", func(c *Context) error {
+		return c.Data(c.PostBody())
+	})
+	url, _ := startTestServer(t, m, ServerConfig{Name: "Test", MaxRequestBodySize: 8})
+	defer m.Shutdown(ktx.Background())
+
+	req, res := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(res)
+	req.Header.SetMethod(POST)
+	req.SetRequestURI(url + "/echo")
+	req.SetBodyString("1234")
+	assert.Nil(t, fasthttp.Do(req, res))
+	assert.Equal(t, "1234", string(res.Body()))
+	assert.Equal(t, "Test", string(res.Header.Server()))
+
+	req.SetBodyString("0123456789")
+	assert.Nil(t, fasthttp.Do(req, res))
+	assert.Equal(t, StatusBadRequest, res.StatusCode(), "oversized body rejected")
+}
+
+func TestServerConfigIdleTimeout(t *testing.T) {
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String("ok")
+	})
+	url, _ := startTestServer(t, m, ServerConfig{ReadTimeout: time.Minute, IdleTimeout: 100 * time.Millisecond})
+	defer m.Shutdown(ktx.Background())
+
+	conn, err := net.Dial("tcp4", url[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	var res fasthttp.Response
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		assert.Nil(t, res.Read(br))
+		assert.Equal(t, "ok", string(res.Body()))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = br.ReadByte()
+	assert.Equal(t, io.EOF, err, "idle connection closed")
+}
+
+func TestListenNetwork(t *testing.T) {
+	tests := []struct {
+		addr, network string
+	}{
+		{"0.0.0.0:8000", "tcp4"},
+		{"127.0.0.1:8000", "tcp4"},
+		{"localhost:8000", "tcp4"},
+		{":8000", "tcp"},
+		{"[::]:8000", "tcp"},
+		{"[::1]:8000", "tcp6"},
+		{"[fe80::1]:8000", "tcp6"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.network, listenNetwork(test.addr), "listenNetwork("+test.addr+") =")
+	}
+}
+
+func TestServeIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback is not available")
+	}
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String("ok")
+	})
+	go m.Serve(ln)
+	defer m.Shutdown(ktx.Background())
+
+	client := &fasthttp.Client{Dial: fasthttp.DialDualStack}
+	status, body, err := client.Get(nil, "http://"+ln.Addr().String()+"/")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusOK, status)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "macross")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "macross.sock")
+
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String("ok")
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- m.ListenUnix(path, 0600)
+	}()
+
+	client := &fasthttp.Client{
+		Dial: func(string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}
+	var status int
+	var body []byte
+	for i := 0; i < 100; i++ {
+		if status, body, err = client.Get(nil, "http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, StatusOK, status)
+	assert.Equal(t, "ok", string(body))
+
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	assert.Equal(t, ErrServerClosed, <-served)
+
+	// the socket left behind is replaced, but not a regular file or a directory
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	m = New()
+	m.Get("/", func(c *Context) error { return nil })
+	served = make(chan error, 1)
+	go func() {
+		served <- m.ListenUnix(path, 0600)
+	}()
+	for i := 0; i < 100; i++ {
+		if _, _, err = client.Get(nil, "http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err, "stale socket replaced")
+	assert.Nil(t, m.Shutdown(ktx.Background()))
+	assert.Equal(t, ErrServerClosed, <-served)
+
+	file := filepath.Join(dir, "data.txt")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("keep"), 0600))
+	assert.NotNil(t, New().ListenUnix(file, 0600))
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "keep", string(data), "regular file kept")
+	assert.NotNil(t, New().ListenUnix(dir, 0600))
+	_, err = os.Stat(dir)
+	assert.Nil(t, err, "directory kept")
+}
+
+func TestActivationListeners(t *testing.T) {
+	lns, err := activationListeners(listenFdsStart)
+	assert.Nil(t, err)
+	assert.Nil(t, lns, "not activated")
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	lns, err = activationListeners(int(f.Fd()))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(lns))
+	assert.Equal(t, "", os.Getenv("LISTEN_FDS"), "LISTEN_FDS unset")
+
+	m := New()
+	m.Get("/", func(c *Context) error {
+		return c.String("ok")
+	})
+	go m.Serve(lns[0])
+	defer m.Shutdown(ktx.Background())
+
+	status, body, err := fasthttp.Get(nil, "http://"+ln.Addr().String()+"/")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusOK, status)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestGetAddress(t *testing.T) {
+	host, port := os.Getenv("HOST"), os.Getenv("PORT")
+	os.Unsetenv("HOST")
+	os.Unsetenv("PORT")
+	defer os.Setenv("HOST", host)
+	defer os.Setenv("PORT", port)
+
+	assert.Equal(t, "0.0.0.0:8000", GetAddress())
+	assert.Equal(t, "0.0.0.0:9000", GetAddress(9000))
+	assert.Equal(t, "0.0.0.0:9000", GetAddress(":9000"))
+	assert.Equal(t, "127.0.0.1:9000", GetAddress("127.0.0.1:9000"))
+	assert.Equal(t, "localhost:8000", GetAddress("localhost"))
+	assert.Equal(t, "[::1]:9000", GetAddress("[::1]:9000"))
+	assert.Equal(t, "[::]:8000", GetAddress("::"))
+	assert.Equal(t, "[::1]:9000", GetAddress("::1", 9000))
+}
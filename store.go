@@ -20,11 +20,9 @@ type store struct {
 func newStore() *store {
 	return &store{
 		root: &node{
-			static:    true,
-			children:  make([]*node, 256),
-			pchildren: make([]*node, 0),
-			pindex:    -1,
-			pnames:    []string{},
+			static: true,
+			pindex: -1,
+			pnames: []string{},
 		},
 	}
 }
@@ -59,7 +57,8 @@ type node struct {
 	order    int // the order at which the data was added. used to be pick the first one when matching multiple
 	minOrder int // minimum order among all the child nodes and this node
 
-	children  []*node // child static nodes, indexed by the first byte of each child key
+	indices   string  // the first bytes of the keys of the static children, sorted
+	children  []*node // child static nodes, in the order of indices
 	pchildren []*node // child param nodes
 
 	regex  *regexp.Regexp // regular expression for a param node containing regular expression key
@@ -94,7 +93,7 @@ func (n *node) add(key string, data interface{}, order int) int {
 		newKey := key[matched:]
 
 		// try adding to a static child
-		if child := n.children[newKey[0]]; child != nil {
+		if child := n.child(newKey[0]); child != nil {
 			if pn := child.add(newKey, data, order); pn >= 0 {
 				return pn
 			}
@@ -122,6 +121,7 @@ func (n *node) add(key string, data interface{}, order int) int {
 		order:     n.order,
 		minOrder:  n.minOrder,
 		pchildren: n.pchildren,
+		indices:   n.indices,
 		children:  n.children,
 		pindex:    n.pindex,
 		pnames:    n.pnames,
@@ -129,9 +129,10 @@ func (n *node) add(key string, data interface{}, order int) int {
 
 	n.key = key[0:matched]
 	n.data = nil
-	n.pchildren = make([]*node, 0)
-	n.children = make([]*node, 256)
-	n.children[n1.key[0]] = n1
+	n.pchildren = nil
+	n.indices = ""
+	n.children = nil
+	n.setChild(n1)
 
 	return n.add(key, data, order)
 }
@@ -153,15 +154,13 @@ func (n *node) addChild(key string, data interface{}, order int) int {
 	if p0 > 0 && p1 > 0 || p1 < 0 {
 		// param token occurs after a static string, or no param token: create a static node
 		child := &node{
-			static:    true,
-			key:       key,
-			minOrder:  order,
-			children:  make([]*node, 256),
-			pchildren: make([]*node, 0),
-			pindex:    n.pindex,
-			pnames:    n.pnames,
+			static:   true,
+			key:      key,
+			minOrder: order,
+			pindex:   n.pindex,
+			pnames:   n.pnames,
 		}
-		n.children[key[0]] = child
+		n.setChild(child)
 		if p1 > 0 {
 			// param token occurs after a static string
 			child.key = key[:p0]
@@ -176,13 +175,11 @@ func (n *node) addChild(key string, data interface{}, order int) int {
 
 	// add param node
 	child := &node{
-		static:    false,
-		key:       key[p0 : p1+1],
-		minOrder:  order,
-		children:  make([]*node, 256),
-		pchildren: make([]*node, 0),
-		pindex:    n.pindex,
-		pnames:    n.pnames,
+		static:   false,
+		key:      key[p0 : p1+1],
+		minOrder: order,
+		pindex:   n.pindex,
+		pnames:   n.pnames,
 	}
 	pattern := ""
 	pname := key[p0+1 : p1]
@@ -215,7 +212,8 @@ func (n *node) addChild(key string, data interface{}, order int) int {
 	return child.addChild(key[p1+1:], data, order)
 }
 
-// get returns the data item with the key matching the tree rooted at the current node
+// get returns the data item with the key matching the tree rooted at the current node.
+// The parameter values are not recorded if pvalues is nil.
 func (n *node) get(key string, pvalues []string) (data interface{}, pnames []string, order int) {
 	order = math.MaxInt32
 
@@ -236,10 +234,14 @@ repeat:
 	} else if n.regex != nil {
 		// param node with regular expression
 		if n.regex.String() == "^.*" {
-			pvalues[n.pindex] = key
+			if pvalues != nil {
+				pvalues[n.pindex] = key
+			}
 			key = ""
 		} else if match := n.regex.FindStringIndex(key); match != nil {
-			pvalues[n.pindex] = key[0:match[1]]
+			if pvalues != nil {
+				pvalues[n.pindex] = key[0:match[1]]
+			}
 			key = key[match[1]:]
 		} else {
 			return
@@ -249,20 +251,24 @@ repeat:
 		i, kl := 0, len(key)
 		for ; i < kl; i++ {
 			if key[i] == '/' {
-				pvalues[n.pindex] = key[0:i]
+				if pvalues != nil {
+					pvalues[n.pindex] = key[0:i]
+				}
 				key = key[i:]
 				break
 			}
 		}
 		if i == kl {
-			pvalues[n.pindex] = key
+			if pvalues != nil {
+				pvalues[n.pindex] = key
+			}
 			key = ""
 		}
 	}
 
 	if len(key) > 0 {
 		// find a static child that can match the rest of the key
-		if child := n.children[key[0]]; child != nil {
+		if child := n.child(key[0]); child != nil {
 			if len(n.pchildren) == 0 {
 				// use goto to avoid recursion when no param children
 				n = child
@@ -276,21 +282,19 @@ repeat:
 	}
 
 	// try matching param children
-	tvalues := pvalues
-	allocated := false
 	for _, child := range n.pchildren {
 		if child.minOrder >= order {
 			continue
 		}
-		if data != nil && !allocated {
-			tvalues = make([]string, len(pvalues))
-			allocated = true
+		if data == nil {
+			data, pnames, order = child.get(key, pvalues)
+			continue
 		}
-		if d, p, s := child.get(key, tvalues); d != nil && s < order {
-			if allocated {
-				for i := child.pindex; i < len(p); i++ {
-					pvalues[i] = tvalues[i]
-				}
+		// not to overwrite the parameter values of the data item found already,
+		// the child is first matched without them and matched again only if it wins
+		if d, p, s := child.get(key, nil); d != nil && s < order {
+			if pvalues != nil {
+				child.get(key, pvalues)
 			}
 			data, pnames, order = d, p, s
 		}
@@ -299,12 +303,37 @@ repeat:
 	return
 }
 
+// child returns the static child whose key starts with the given byte, or nil if there is none.
+func (n *node) child(c byte) *node {
+	// nodes have few children: a linear scan is faster than a binary search
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == c {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// setChild adds a static child, replacing the one whose key starts with the same byte if any.
+func (n *node) setChild(child *node) {
+	c := child.key[0]
+	i := 0
+	for ; i < len(n.indices) && n.indices[i] < c; i++ {
+	}
+	if i < len(n.indices) && n.indices[i] == c {
+		n.children[i] = child
+		return
+	}
+	n.indices = n.indices[:i] + string(c) + n.indices[i:]
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
+}
+
 func (n *node) print(level int) string {
 	r := fmt.Sprintf("%v{key: %v, regex: %v, data: %v, order: %v, minOrder: %v, pindex: %v, pnames: %v}\n", strings.Repeat(" ", level<<2), n.key, n.regex, n.data, n.order, n.minOrder, n.pindex, n.pnames)
 	for _, child := range n.children {
-		if child != nil {
-			r += child.print(level + 1)
-		}
+		r += child.print(level + 1)
 	}
 	for _, child := range n.pchildren {
 		r += child.print(level + 1)
@@ -158,3 +158,77 @@ func TestStoreGet(t *testing.T) {
 		assert.Equal(t, test.params, params, "store.Get("+test.key+").params =")
 	}
 }
+
+func benchmarkStoreGet(b *testing.B, path string) {
+	s := newStore()
+	maxParams := 0
+	for i, key := range []string{"/users/<id>/edit", "/users", "/users/new", "/users/<id>", "/users/<id>/posts/<post>", "/static/<:.*>"} {
+		if n := s.Add(key, i); n > maxParams {
+			maxParams = n
+		}
+	}
+	pvalues := make([]string, maxParams)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Get(path, pvalues)
+	}
+}
+
+func BenchmarkStoreGetStatic(b *testing.B) {
+	benchmarkStoreGet(b, "/users/new")
+}
+
+func BenchmarkStoreGetParam(b *testing.B) {
+	benchmarkStoreGet(b, "/users/42/posts/hello")
+}
+
+// largeRouteTable returns the paths of a route table of 3,200 routes.
+func largeRouteTable() []string {
+	var keys []string
+	for i := 0; i < 100; i++ {
+		resource := fmt.Sprintf("/api/v%d/resource%d", i%3+1, i)
+		keys = append(keys,
+			resource,
+			resource+"/new",
+			resource+"/<id>",
+			resource+"/<id>/edit",
+			resource+"/<id>/history/<version:\\d+>",
+			resource+"/search/<query>",
+			resource+"/export.csv",
+			resource+"/export.json",
+		)
+		for j := 0; j < 24; j++ {
+			keys = append(keys, fmt.Sprintf("%v/<id>/items%d/<item>", resource, j))
+		}
+	}
+	return keys
+}
+
+func BenchmarkStoreAddLarge(b *testing.B) {
+	keys := largeRouteTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := newStore()
+		for j, key := range keys {
+			s.Add(key, j)
+		}
+	}
+}
+
+func BenchmarkStoreGetLarge(b *testing.B) {
+	s := newStore()
+	for i, key := range largeRouteTable() {
+		s.Add(key, i)
+	}
+	pvalues := make([]string, 3)
+	paths := []string{"/api/v2/resource49/new", "/api/v3/resource77/42/items17/abc", "/api/v1/resource99/export.json"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if data, _ := s.Get(paths[i%len(paths)], pvalues); data == nil {
+			b.Fatal("no route matched")
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package macross
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type (
+	// CertificateFile is a pair of PEM encoded certificate and private key files.
+	CertificateFile struct {
+		CertFile string `json:"cert_file"`
+		KeyFile  string `json:"key_file"`
+	}
+
+	// TLSConfig defines the config for a CertReloader.
+	TLSConfig struct {
+		// Certificates lists the certificates to serve.
+		// The certificate of a connection is picked by matching the SNI server name
+		// against the DNS names of the certificates, wildcards included.
+		// The first certificate is served when no name matches.
+		// Required.
+		Certificates []CertificateFile `json:"certificates"`
+
+		// MinVersion is the minimum accepted TLS version.
+		// Optional. Default value tls.VersionTLS12.
+		MinVersion uint16 `json:"min_version"`
+
+		// CipherSuites restricts the cipher suites of TLS 1.2 and below.
+		// Optional. The crypto/tls defaults are used if empty.
+		CipherSuites []uint16 `json:"cipher_suites"`
+
+		// ReloadInterval is how often the certificate files are checked for changes.
+		// Optional. The files are only reloaded on demand if zero.
+		ReloadInterval time.Duration `json:"reload_interval"`
+
+		// OnReloadError is called when a background reload fails.
+		// The previously loaded certificates are kept in this case.
+		// Optional. Default value logs the error with the standard logger.
+		OnReloadError func(error)
+	}
+
+	// CertReloader serves TLS certificates picked by SNI and reloads them from disk
+	// when the files change, when a signal is received, or when Reload is called.
+	CertReloader struct {
+		config TLSConfig
+		certs  atomic.Value // *certSet
+		mutex  sync.Mutex   // serializes reloads
+		stop   chan struct{}
+		once   sync.Once
+	}
+
+	// certSet is an immutable set of loaded certificates.
+	certSet struct {
+		certs    []*tls.Certificate
+		names    map[string]*tls.Certificate // lower-cased DNS names, including wildcard patterns
+		modTimes []time.Time                 // the latest modification time of each certificate's files
+	}
+)
+
+var (
+	// DefaultTLSConfig is the default CertReloader config.
+	DefaultTLSConfig = TLSConfig{
+		MinVersion: tls.VersionTLS12,
+		OnReloadError: func(err error) {
+			log.Printf("macross: cannot reload certificates: %s", err)
+		},
+	}
+)
+
+// NewCertReloader loads the certificates listed in config.
+// If config.ReloadInterval is set, the files are watched until Close is called.
+func NewCertReloader(config TLSConfig) (*CertReloader, error) {
+	// Defaults
+	if len(config.Certificates) == 0 {
+		return nil, errors.New("no certificate to load")
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = DefaultTLSConfig.MinVersion
+	}
+	if config.OnReloadError == nil {
+		config.OnReloadError = DefaultTLSConfig.OnReloadError
+	}
+
+	r := &CertReloader{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if config.ReloadInterval > 0 {
+		go r.watch()
+	}
+	return r, nil
+}
+
+// TLSConfig returns a tls.Config serving the certificates of the reloader,
+// to be used as ServerConfig.TLSConfig.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:               r.config.MinVersion,
+		CipherSuites:             r.config.CipherSuites,
+		PreferServerCipherSuites: true,
+		GetCertificate:           r.GetCertificate,
+	}
+}
+
+// GetCertificate returns the certificate matching the server name of the client hello.
+// It can be used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := r.certs.Load().(*certSet)
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, okay := set.names[name]; okay {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, okay := set.names["*"+name[i:]]; okay {
+			return cert, nil
+		}
+	}
+	return set.certs[0], nil
+}
+
+// Reload loads the certificate files again.
+// If any of them cannot be loaded, the previous certificates are kept and the error is returned.
+func (r *CertReloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	set := &certSet{
+		certs:    make([]*tls.Certificate, len(r.config.Certificates)),
+		names:    make(map[string]*tls.Certificate),
+		modTimes: make([]time.Time, len(r.config.Certificates)),
+	}
+	for i, file := range r.config.Certificates {
+		modTime, err := file.modTime()
+		if err != nil {
+			return err
+		}
+		cert, err := tls.LoadX509KeyPair(file.CertFile, file.KeyFile)
+		if err != nil {
+			return err
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, exists := set.names[name]; !exists {
+				set.names[name] = &cert
+			}
+		}
+		set.certs[i] = &cert
+		set.modTimes[i] = modTime
+	}
+	r.certs.Store(set)
+	return nil
+}
+
+// ReloadOnSignal reloads the certificates whenever the process receives one of
+// the given signals, or SIGHUP if no signal is specified, until Close is called.
+func (r *CertReloader) ReloadOnSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-sigs:
+				if err := r.Reload(); err != nil {
+					r.config.OnReloadError(err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching the certificate files and the signals.
+func (r *CertReloader) Close() error {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	return nil
+}
+
+// watch reloads the certificates whenever their files change.
+func (r *CertReloader) watch() {
+	ticker := time.NewTicker(r.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.changed() {
+				if err := r.Reload(); err != nil {
+					r.config.OnReloadError(err)
+				}
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// changed reports whether any certificate file was modified since the last reload.
+func (r *CertReloader) changed() bool {
+	set := r.certs.Load().(*certSet)
+	for i, file := range r.config.Certificates {
+		if modTime, err := file.modTime(); err == nil && !modTime.Equal(set.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// modTime returns the latest modification time of the certificate and key files.
+func (f CertificateFile) modTime() (time.Time, error) {
+	cert, err := os.Stat(f.CertFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	key, err := os.Stat(f.KeyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if key.ModTime().After(cert.ModTime()) {
+		return key.ModTime(), nil
+	}
+	return cert.ModTime(), nil
+}
@@ -0,0 +1,178 @@
+package macross
+
+import (
+	"bufio"
+	ktx "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// writeTestCertificate writes a self-signed certificate for the given DNS names into dir.
+func writeTestCertificate(t *testing.T, dir, name string, serial int64, dnsNames ...string) CertificateFile {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := CertificateFile{
+		CertFile: filepath.Join(dir, name+".pem"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	ioutil.WriteFile(file.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(file.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return file
+}
+
+func serialFor(t *testing.T, r *CertReloader, serverName string) int64 {
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderSNI(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "macross")
+	defer os.RemoveAll(dir)
+
+	r, err := NewCertReloader(TLSConfig{Certificates: []CertificateFile{
+		writeTestCertificate(t, dir, "a", 1, "a.example.com"),
+		writeTestCertificate(t, dir, "b", 2, "b.example.com", "*.b.example.com"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	assert.Equal(t, int64(1), serialFor(t, r, "a.example.com"))
+	assert.Equal(t, int64(2), serialFor(t, r, "B.example.com."))
+	assert.Equal(t, int64(2), serialFor(t, r, "x.b.example.com"))
+	assert.Equal(t, int64(1), serialFor(t, r, "x.y.b.example.com"), "wildcards match one label")
+	assert.Equal(t, int64(1), serialFor(t, r, ""), "default certificate")
+
+	_, err = NewCertReloader(TLSConfig{})
+	assert.NotNil(t, err)
+	_, err = NewCertReloader(TLSConfig{Certificates: []CertificateFile{{filepath.Join(dir, "x.pem"), filepath.Join(dir, "x.key")}}})
+	assert.NotNil(t, err)
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "macross")
+	defer os.RemoveAll(dir)
+
+	file := writeTestCertificate(t, dir, "a", 1, "a.example.com")
+	errs := make(chan error, 1)
+	r, err := NewCertReloader(TLSConfig{
+		Certificates:   []CertificateFile{file},
+		ReloadInterval: 10 * time.Millisecond,
+		OnReloadError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// a broken file keeps the previous certificate
+	ioutil.WriteFile(file.CertFile, []byte("broken"), 0600)
+	assert.NotNil(t, r.Reload())
+	assert.Equal(t, int64(1), serialFor(t, r, "a.example.com"))
+	select {
+	case err := <-errs:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the watcher did not report the broken file")
+	}
+
+	// a changed file is picked up by the watcher
+	writeTestCertificate(t, dir, "a", 3, "a.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(file.CertFile, future, future)
+	for i := 0; i < 100 && serialFor(t, r, "a.example.com") != 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(3), serialFor(t, r, "a.example.com"))
+
+	// an explicit reload picks up the files as well
+	writeTestCertificate(t, dir, "a", 4, "a.example.com")
+	assert.Nil(t, r.Reload())
+	assert.Equal(t, int64(4), serialFor(t, r, "a.example.com"))
+}
+
+func TestServeTLSConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "macross")
+	defer os.RemoveAll(dir)
+
+	r, err := NewCertReloader(TLSConfig{Certificates: []CertificateFile{
+		writeTestCertificate(t, dir, "a", 1, "a.example.com"),
+		writeTestCertificate(t, dir, "b", 2, "b.example.com"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m := New()
+	m.Get("/", func(c *Context) error {
+		if c.IsTLS() {
+			return c.String("tls")
+		}
+		return c.String("plain")
+	})
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.ServeWithConfig(ServerConfig{TLSConfig: r.TLSConfig()}, ln)
+	defer m.Shutdown(ktx.Background())
+
+	conn, err := tls.Dial("tcp4", ln.Addr().String(), &tls.Config{ServerName: "b.example.com", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"b.example.com"}, conn.ConnectionState().PeerCertificates[0].DNSNames)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: b.example.com\r\n\r\n"))
+	assert.Nil(t, err)
+	var res fasthttp.Response
+	assert.Nil(t, res.Read(bufio.NewReader(conn)))
+	assert.Equal(t, "tls", string(res.Body()))
+	conn.Close()
+
+	_, err = tls.Dial("tcp4", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11})
+	assert.NotNil(t, err, "TLS 1.1 is rejected")
+}
@@ -0,0 +1,96 @@
+package macross
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type (
+	// Validator is implemented by request types that check their own fields once they are bound.
+	// See `Typed()`.
+	Validator interface {
+		Validate() error
+	}
+)
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Typed turns a function of the form
+//
+//	func(c *Context, req *Request) (*Response, error)
+//
+// into a Handler. For each request, the response type is negotiated first: a request that accepts
+// neither JSON nor XML responds with "406 - Not Acceptable" before the function is called. The route
+// may declare the types it produces instead, see `Route#Produces()`. A new *Request is then bound by
+// `Macross#Binder()`, unless the request has no body and is not a GET request, and validated
+// if it implements Validator. The function is called, and the response it returns is written in
+// the negotiated type, with the status code of the response, "200 - OK" unless the function sets
+// another one. A nil response writes "204 - No Content".
+//
+// Binding failures respond with "415 - Unsupported Media Type" for an unknown content type and
+// "400 - Bad Request" otherwise, as do validation failures. Errors returned by the function are
+// handled as those of any other handler.
+//
+// The signature of the function is checked once, and Typed panics if it is not of the above form.
+//
+//	m.Post("/users", macross.Typed(func(c *macross.Context, req *CreateUserRequest) (*User, error) {
+//		return users.Create(req.Name, req.Email)
+//	}))
+func Typed(fn interface{}) Handler {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 ||
+		t.In(0) != contextType || t.In(1).Kind() != reflect.Ptr || t.Out(1) != errorType {
+		panic(fmt.Sprintf("typed handler must be of the form func(*Context, *Request) (Response, error), got %v", t))
+	}
+	f, reqType := reflect.ValueOf(fn), t.In(1).Elem()
+
+	return func(c *Context) error {
+		ctype := c.ResponseType()
+		if ctype == "" {
+			c.Response.Header.Add(HeaderVary, HeaderAccept)
+			ctype = c.Negotiate(MIMEApplicationJSON, MIMEApplicationXML)
+		}
+		if ctype != MIMEApplicationJSON && ctype != MIMEApplicationXML {
+			return ErrNotAcceptable
+		}
+
+		req := reflect.New(reqType)
+		if len(c.Request.Body()) > 0 || string(c.Method()) == GET {
+			if err := c.macross.Binder().Bind(req.Interface(), c); err != nil {
+				return badRequest(err)
+			}
+		}
+		if v, okay := req.Interface().(Validator); okay {
+			if err := v.Validate(); err != nil {
+				return badRequest(err)
+			}
+		}
+
+		out := f.Call([]reflect.Value{reflect.ValueOf(c), req})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return err
+		}
+		resp := out[0]
+		if (resp.Kind() == reflect.Ptr || resp.Kind() == reflect.Interface) && resp.IsNil() {
+			return c.NoContent(StatusNoContent)
+		}
+
+		status := c.Response.StatusCode()
+		if ctype == MIMEApplicationXML {
+			return c.XML(resp.Interface(), status)
+		}
+		return c.JSON(resp.Interface(), status)
+	}
+}
+
+// badRequest turns a binding or validation error into an HTTPError,
+// keeping the status of errors that already are.
+func badRequest(err error) error {
+	if _, okay := err.(*HTTPError); okay {
+		return err
+	}
+	return NewHTTPError(StatusBadRequest, err.Error())
+}
@@ -0,0 +1,123 @@
+package macross
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type (
+	typedUserRequest struct {
+		Name  string `json:"name" form:"name"`
+		Email string `json:"email" form:"email"`
+	}
+
+	typedUser struct {
+		ID   int    `json:"id" xml:"id"`
+		Name string `json:"name" xml:"name"`
+	}
+)
+
+func (r *typedUserRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestTyped(t *testing.T) {
+	m := New()
+	created := 0
+	m.Post("/users", Typed(func(c *Context, req *typedUserRequest) (*typedUser, error) {
+		created++
+		if req.Name == "root" {
+			return nil, NewHTTPError(StatusConflict, "name taken")
+		}
+		c.Response.SetStatusCode(StatusCreated)
+		return &typedUser{ID: 1, Name: req.Name}, nil
+	}))
+	m.Get("/users", Typed(func(c *Context, req *typedUserRequest) (interface{}, error) {
+		return []typedUser{{ID: 1, Name: req.Name}}, nil
+	}))
+	m.Delete("/users", Typed(func(c *Context, req *typedUserRequest) (*typedUser, error) {
+		return nil, nil
+	}))
+	m.Delete("/users/<id>", Typed(func(c *Context, req *struct{}) (*typedUser, error) {
+		return nil, nil
+	}))
+
+	tests := []struct {
+		id, method, uri, ctype, accept, body string
+		status                               int
+		response                             string
+	}{
+		{"json", POST, "/users", MIMEApplicationJSON, "", `{"name":"ann"}`, StatusCreated, `{"id":1,"name":"ann"}`},
+		{"xml", POST, "/users", MIMEApplicationJSON, "text/html, application/xml;q=0.9, */*;q=0.1", `{"name":"ann"}`, StatusCreated, xml.Header + `<typedUser><id>1</id><name>ann</name></typedUser>`},
+		{"form", POST, "/users", MIMEApplicationForm, "application/*", `name=bob`, StatusCreated, `{"id":1,"name":"bob"}`},
+		{"query", GET, "/users?name=eve", "", "", "", StatusOK, `[{"id":1,"name":"eve"}]`},
+		{"unsupported media type", POST, "/users", MIMETextPlain, "", `ann`, StatusUnsupportedMediaType, "Unsupported Media Type"},
+		{"syntax error", POST, "/users", MIMEApplicationJSON, "", `{"name":`, StatusBadRequest, ""},
+		{"validation", POST, "/users", MIMEApplicationJSON, "", `{"email":"a@b.c"}`, StatusBadRequest, "name is required"},
+		{"handler error", POST, "/users", MIMEApplicationJSON, "", `{"name":"root"}`, StatusConflict, "name taken"},
+		{"not acceptable", POST, "/users", MIMEApplicationJSON, "text/html", `{"name":"ann"}`, StatusNotAcceptable, "Not Acceptable"},
+		{"no content", DELETE, "/users", MIMEApplicationJSON, "", `{"name":"ann"}`, StatusNoContent, ""},
+		{"no body", DELETE, "/users/1", "", "", "", StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		created = 0
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		ctx.Request.Header.SetContentType(test.ctype)
+		if test.accept != "" {
+			ctx.Request.Header.Set(HeaderAccept, test.accept)
+		}
+		ctx.Request.SetBodyString(test.body)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.id)
+		if test.response != "" {
+			assert.Equal(t, test.response, string(ctx.Response.Body()), test.id)
+		}
+		if test.status == StatusNotAcceptable {
+			assert.Equal(t, 0, created, "the handler does not run: "+test.id)
+		}
+	}
+}
+
+func TestTypedSignature(t *testing.T) {
+	invalid := []interface{}{
+		nil,
+		func(c *Context) error { return nil },
+		func(c *Context, req typedUserRequest) (*typedUser, error) { return nil, nil },
+		func(req *typedUserRequest, c *Context) (*typedUser, error) { return nil, nil },
+		func(c *Context, req *typedUserRequest) (*typedUser, bool) { return nil, false },
+	}
+	for _, fn := range invalid {
+		assert.Panics(t, func() { Typed(fn) })
+	}
+	assert.NotPanics(t, func() {
+		Typed(func(c *Context, req *typedUserRequest) (typedUser, error) { return typedUser{}, nil })
+	})
+}
+
+func TestContextNegotiate(t *testing.T) {
+	tests := []struct {
+		accept, expected string
+	}{
+		{"", MIMEApplicationJSON},
+		{"*/*", MIMEApplicationJSON},
+		{"application/xml", MIMEApplicationXML},
+		{"Application/XML, application/json;q=0.5", MIMEApplicationXML},
+		{"application/*;q=0.5, application/json;q=0.1", MIMEApplicationXML},
+		{"application/json;q=0, */*", MIMEApplicationXML},
+		{"text/html", ""},
+	}
+	for _, test := range tests {
+		c := &Context{RequestCtx: &fasthttp.RequestCtx{}}
+		c.Request.Header.Set(HeaderAccept, test.accept)
+		assert.Equal(t, test.expected, c.Negotiate(MIMEApplicationJSON, MIMEApplicationXML), test.accept)
+	}
+}
@@ -0,0 +1,295 @@
+package macross
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// VersionConfig defines the config of the API versions of a route group.
+	VersionConfig struct {
+		// Prefix is the prefix of the version numbers in the URL paths, like "/api/v2/users".
+		// Optional. Default value "v".
+		Prefix string `json:"prefix"`
+
+		// Vendor is the vendor name of the media types requesting a version in the Accept header,
+		// such as "acme" for "application/vnd.acme.v2+json".
+		// Optional. If empty, the versions are only requested by URL path.
+		Vendor string `json:"vendor"`
+
+		// Default is the version serving the requests whose path has no version and which
+		// don't request one in their Accept header.
+		// Optional. Default value is the latest version.
+		Default int `json:"default"`
+
+		// Context key to store the version serving the request into context.
+		// Optional. Default value "version".
+		ContextKey string `json:"context_key"`
+	}
+
+	// Versions routes the requests of a route group to the routes of the API version they request,
+	// or of the nearest older version that has a route for them. See `RouteGroup#Versions()`.
+	Versions struct {
+		config     VersionConfig
+		group      *RouteGroup         // the route group of the versions, whose handlers don't change
+		aliases    *RouteGroup         // the route group of the routes dispatching to the versions, without handlers
+		notFound   []Handler           // the handler chain of the requests no version has a route for
+		groups     map[int]*RouteGroup // the route groups by version
+		numbers    []int               // the versions, in ascending order
+		deprecated map[int]deprecation
+	}
+
+	// deprecation is when a version was deprecated and when it stops being served.
+	deprecation struct {
+		since, sunset time.Time
+	}
+)
+
+var (
+	// DefaultVersionConfig is the default API versions config.
+	DefaultVersionConfig = VersionConfig{
+		Prefix:     "v",
+		ContextKey: "version",
+	}
+)
+
+// Versions returns an API versions router for the route group, with the default config.
+// See `VersionsWithConfig()`.
+func (r *RouteGroup) Versions() *Versions {
+	return r.VersionsWithConfig(DefaultVersionConfig)
+}
+
+// VersionsWithConfig returns an API versions router for the route group. The routes of each version
+// are registered with the route group returned by `Versions#Version()`, under the prefix of the version:
+//
+//	versions := m.Group("/api").Versions()
+//	versions.Version(1).Get("/users", listUsersV1) // GET /api/v1/users
+//	versions.Version(2).Get("/users", listUsersV2) // GET /api/v2/users
+//
+// When the routes are frozen, each version is completed with the routes of the older versions it doesn't
+// override, such as "/api/v2/legacy" served by "/api/v1/legacy". The paths without version, like
+// "/api/users", are served by the version requested by the Accept header, such as
+// "application/vnd.acme.v2+json" for the vendor "acme", or by the nearest older version having
+// a route for them. Without version requested, the default version serves them.
+func (r *RouteGroup) VersionsWithConfig(config VersionConfig) *Versions {
+	// Defaults
+	if config.Prefix == "" {
+		config.Prefix = DefaultVersionConfig.Prefix
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = DefaultVersionConfig.ContextKey
+	}
+
+	v := &Versions{
+		config:     config,
+		group:      r.Group(""),
+		groups:     make(map[int]*RouteGroup),
+		deprecated: make(map[int]deprecation),
+	}
+	v.aliases = newRouteGroup(r.prefix, r.macross, nil)
+	v.aliases.host, v.aliases.name = r.host, r.name
+	v.notFound = combineHandlers(v.group.handlers, []Handler{func(*Context) error {
+		return ErrNotFound
+	}})
+	r.macross.freezeHooks = append(r.macross.freezeHooks, v.compile)
+	return v
+}
+
+// Version returns the route group of an API version, a positive number.
+// The handlers registered with the group only apply to the routes of the version.
+func (v *Versions) Version(n int) *RouteGroup {
+	if n <= 0 {
+		panic("macross: invalid API version " + strconv.Itoa(n))
+	}
+	if group, exists := v.groups[n]; exists {
+		return group
+	}
+	group := v.group.Group(v.prefix(n), func(c *Context) error {
+		v.serve(c, n)
+		return nil
+	})
+	v.groups[n] = group
+	v.numbers = append(v.numbers, n)
+	sort.Ints(v.numbers)
+	return group
+}
+
+// Deprecate marks an API version as deprecated since the given time. The responses of the version then carry
+// a Deprecation header, and a Sunset header with the time it stops being served, unless sunset is zero.
+func (v *Versions) Deprecate(n int, since, sunset time.Time) {
+	v.deprecated[n] = deprecation{since: since, sunset: sunset}
+}
+
+// prefix returns the path prefix of a version.
+func (v *Versions) prefix(n int) string {
+	return "/" + v.config.Prefix + strconv.Itoa(n)
+}
+
+// serve records the version serving the request and adds its deprecation headers,
+// unless a version is already serving it.
+func (v *Versions) serve(c *Context, n int) {
+	if c.Get(v.config.ContextKey) != nil {
+		return
+	}
+	c.Set(v.config.ContextKey, n)
+	if d, deprecated := v.deprecated[n]; deprecated {
+		c.Response.Header.Set(HeaderDeprecation, "@"+strconv.FormatInt(d.since.Unix(), 10))
+		if !d.sunset.IsZero() {
+			c.Response.Header.Set(HeaderSunset, d.sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+}
+
+// requested returns the version requested by the Accept header, or the default version.
+func (v *Versions) requested(c *Context) int {
+	if v.config.Vendor != "" {
+		prefix := "application/vnd." + strings.ToLower(v.config.Vendor) + "." + v.config.Prefix
+		for _, part := range strings.Split(string(c.Request.Header.Peek(HeaderAccept)), ",") {
+			mtype := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+			if !strings.HasPrefix(mtype, prefix) {
+				continue
+			}
+			number := mtype[len(prefix):]
+			if i := strings.IndexByte(number, '+'); i >= 0 {
+				number = number[:i]
+			}
+			if n, err := strconv.Atoi(number); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	if v.config.Default > 0 {
+		return v.config.Default
+	}
+	return v.numbers[len(v.numbers)-1]
+}
+
+// compile registers the routes of each version that are inherited from the older versions,
+// and the routes of the paths without version. It is called when the routes are frozen.
+func (v *Versions) compile() {
+	if len(v.numbers) == 0 {
+		return
+	}
+	// the paths of the routes of each version, relative to the prefix of the version
+	type route struct {
+		method, path string
+	}
+	var routes []route
+	paths := make(map[int]map[string]bool)
+	table := v.group.macross.table
+	for _, n := range v.numbers {
+		paths[n] = make(map[string]bool)
+		prefix := v.group.prefix + v.prefix(n)
+		for _, entry := range table {
+			path := entry.route.path
+			if entry.route.group.host != v.group.host || !strings.HasPrefix(path, prefix) ||
+				len(path) > len(prefix) && path[len(prefix)] != '/' {
+				continue
+			}
+			r := route{entry.method, path[len(prefix):]}
+			key := routeKey(nil, r.method, r.path)
+			if !paths[n][key] {
+				paths[n][key] = true
+				routes = append(routes, r)
+			}
+		}
+	}
+
+	segments := strings.Count(v.group.prefix, "/")
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		key := routeKey(nil, r.method, r.path)
+		if registered[key] {
+			continue
+		}
+		registered[key] = true
+		for _, n := range v.numbers {
+			if !paths[n][key] && v.inherits(paths, n, key) {
+				v.register(r.method, v.prefix(n)+r.path, v.dispatch(r.method, n, segments))
+			}
+		}
+		v.register(r.method, r.path, v.dispatch(r.method, 0, segments))
+	}
+}
+
+// register registers a route dispatching to the versions, unless the routes registered before
+// already serve all its requests.
+func (v *Versions) register(method, path string, handler Handler) {
+	m := v.group.macross
+	expanded, _ := m.expandParamTypes(v.group.prefix + path)
+	if _, exists := m.tableIndex[routeKey(v.group.host, method, expanded)]; exists {
+		return
+	}
+	if m.shadowing(v.group.host, method, expanded) != nil {
+		return
+	}
+	newRoute(path, v.aliases).add(method, []Handler{handler})
+}
+
+// inherits returns whether a version inherits a route of an older version.
+func (v *Versions) inherits(paths map[int]map[string]bool, n int, key string) bool {
+	for _, older := range v.numbers {
+		if older < n && paths[older][key] {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch returns a handler continuing with the handler chain of the route of the request path
+// in the requested version, or in the nearest older version having one. The version is
+// requested by the path if n is not 0, and by the Accept header otherwise. The request path
+// has the given number of segments before the version or the route path.
+func (v *Versions) dispatch(method string, n, segments int) Handler {
+	mbytes := []byte(method)
+	return func(c *Context) error {
+		requested := n
+		if requested == 0 {
+			requested = v.requested(c)
+			if v.config.Vendor != "" {
+				c.Response.Header.Add(HeaderVary, HeaderAccept)
+			}
+		}
+		c.handlers, c.index = v.notFound, -1
+		i := sort.SearchInts(v.numbers, requested+1) - 1
+		if i < 0 {
+			return nil
+		}
+		v.serve(c, v.numbers[i])
+
+		head, rest := splitPath(string(c.path), segments)
+		if n != 0 {
+			_, rest = splitPath(rest, 1)
+		}
+		rt := c.macross.currentRouting()
+		for ; i >= 0; i-- {
+			k := v.numbers[i]
+			if k == n {
+				continue
+			}
+			// the request is routed with the path of the version, which the route inherited by the version expects
+			c.path = append(append(append(c.path[:0], head...), v.prefix(k)...), rest...)
+			if handlers, pnames := rt.find(c.RequestCtx.Host(), mbytes, b2s(c.path), c.pvalues); handlers != nil {
+				c.handlers, c.pnames = handlers, pnames
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// splitPath splits a path after the given number of segments.
+func splitPath(path string, segments int) (string, string) {
+	i := 0
+	for ; segments > 0 && i < len(path); segments-- {
+		if j := strings.IndexByte(path[i+1:], '/'); j >= 0 {
+			i += j + 1
+		} else {
+			i = len(path)
+		}
+	}
+	return path[:i], path[i:]
+}
@@ -0,0 +1,116 @@
+package macross
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestVersions(t *testing.T) {
+	var buf bytes.Buffer
+	say := func(s string) Handler {
+		return func(c *Context) error {
+			return c.String(fmt.Sprintf("%v %v", s, c.Get("version")))
+		}
+	}
+	m := New()
+	m.Use(newHandler("m", &buf))
+	api := m.Group("/api")
+	versions := api.VersionsWithConfig(VersionConfig{Vendor: "acme"})
+	api.Use(newHandler("a", &buf))
+
+	v1 := versions.Version(1)
+	v1.Use(newHandler("1", &buf))
+	v1.Get("/users", say("v1 users"))
+	v1.Get("/users/<id:int>", func(c *Context) error {
+		return c.String(fmt.Sprintf("v1 user %v", c.Param("id").Value().(int)+1))
+	})
+	v1.Get("/legacy", say("v1 legacy"))
+	v2 := versions.Version(2)
+	v2.Get("/users", say("v2 users"))
+	versions.Version(3).Get("/beta", say("v3 beta"))
+	api.Get("/health", say("health"))
+
+	since := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	versions.Deprecate(1, since, sunset)
+
+	tests := []struct {
+		id, method, path, accept string
+		status                   int
+		body, chain              string
+		deprecated               bool
+	}{
+		{"v1", GET, "/api/v1/users", "", StatusOK, "v1 users 1", "m1", true},
+		{"v2", GET, "/api/v2/users", "", StatusOK, "v2 users 2", "m", false},
+		{"inherited", GET, "/api/v2/legacy", "", StatusOK, "v1 legacy 2", "m1", false},
+		{"inherited param", GET, "/api/v3/users/7", "", StatusOK, "v1 user 8", "m1", false},
+		{"newer", GET, "/api/v1/beta", "", StatusNotFound, "", "m", false},
+		{"default", GET, "/api/users", "", StatusOK, "v2 users 3", "m", false},
+		{"header", GET, "/api/users", "application/vnd.acme.v1+json", StatusOK, "v1 users 1", "m1", true},
+		{"header fallback", GET, "/api/legacy", "application/vnd.acme.v2+json; q=0.9", StatusOK, "v1 legacy 2", "m1", false},
+		{"header newer", GET, "/api/users", "text/html, application/vnd.acme.v7+json", StatusOK, "v2 users 3", "m", false},
+		{"header older", GET, "/api/beta", "application/vnd.acme.v2+json", StatusNotFound, "", "m", false},
+		{"unversioned", GET, "/api/health", "application/vnd.acme.v1+json", StatusOK, "health <nil>", "ma", false},
+		{"head", HEAD, "/api/users", "application/vnd.acme.v1+json", StatusOK, "", "m1", true},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		if test.accept != "" {
+			ctx.Request.Header.Set(HeaderAccept, test.accept)
+		}
+		m.ServeHTTP(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.id)
+		assert.Equal(t, test.chain, buf.String(), test.id)
+		if test.status == StatusOK {
+			assert.Equal(t, test.body, string(ctx.Response.Body()), test.id)
+		}
+		if test.deprecated {
+			assert.Equal(t, "@1451606400", string(ctx.Response.Header.Peek(HeaderDeprecation)), test.id)
+			assert.Equal(t, "Sun, 01 Jan 2017 00:00:00 GMT", string(ctx.Response.Header.Peek(HeaderSunset)), test.id)
+		} else {
+			assert.Equal(t, "", string(ctx.Response.Header.Peek(HeaderDeprecation)), test.id)
+		}
+	}
+
+	var routes []string
+	for _, route := range m.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+	assert.Contains(t, routes, "GET /api/v2/legacy")
+	assert.Contains(t, routes, "GET /api/v3/users/<id:int>")
+	assert.Contains(t, routes, "GET /api/users")
+	assert.NotContains(t, routes, "GET /api/v1/beta")
+	assert.Contains(t, routes, "GET /api/v2/users/<id:int>")
+}
+
+func TestVersionsPath(t *testing.T) {
+	m := New()
+	versions := m.Versions()
+	versions.Version(1).Get("/", func(c *Context) error { return c.String("v1 root") })
+	versions.Version(2).Get("/users/new", func(c *Context) error { return c.String("v2 new") })
+	versions.Version(2).Get("/users/<id>", func(c *Context) error { return c.String("v2 user " + c.Param("id").String()) })
+	versions.Version(1).Get("/users/new", func(c *Context) error { return c.String("v1 new") })
+	versions.Version(1).Get("/users/edit", func(c *Context) error { return c.String("v1 edit") })
+
+	for path, body := range map[string]string{
+		"/":              "v1 root",
+		"/v2/":           "v1 root",
+		"/users/5":       "v2 user 5",
+		"/users/new":     "v2 new",
+		"/v1/users/new":  "v1 new",
+		"/v2/users/edit": "v2 user edit",
+	} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(path)
+		m.ServeHTTP(ctx)
+		assert.Equal(t, body, string(ctx.Response.Body()), path)
+	}
+}